@@ -0,0 +1,251 @@
+/*
+Package fulltext keeps an inverted index of the words in task names and
+notes, for finding tasks by what they say rather than by their fields.
+*/
+package fulltext
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+/*
+Weights given to a word depending on where it appears. A word in the name
+says more about a task than the same word somewhere in its notes.
+*/
+const (
+	nameWeight  = 3.0
+	notesWeight = 1.0
+
+	/*
+		prefixWeight scales down words which only match because they start
+		with a search term, so whole words rank first.
+	*/
+	prefixWeight = 0.5
+)
+
+/*
+Result is a task found by a search, with how well it matched. Higher scores
+are better matches.
+*/
+type Result struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+}
+
+/*
+Index maps words to the tasks they appear in. Words are indexed as written
+(lower cased), and grouped by stem so searching for one form of a word finds
+the others. An index isn't safe for concurrent use, it's up to its owner to
+guard it.
+*/
+type Index struct {
+	/*
+		postings holds, for every word, how strongly it appears in each task
+		containing it.
+	*/
+	postings map[string]map[string]float64
+
+	/*
+		stems holds every indexed word with the stem.
+	*/
+	stems map[string]map[string]bool
+
+	/*
+		words holds every indexed word in sorted order, for finding words by
+		prefix.
+	*/
+	words []string
+
+	/*
+		documents holds the words indexed for each task, so they can be
+		taken out again when the task changes.
+	*/
+	documents map[string][]string
+}
+
+/*
+NewIndex creates an empty index.
+*/
+func NewIndex() *Index {
+	return &Index{
+		postings:  make(map[string]map[string]float64),
+		stems:     make(map[string]map[string]bool),
+		documents: make(map[string][]string),
+	}
+}
+
+/*
+Put indexes the name and notes of a task, replacing anything indexed for it
+before.
+*/
+func (x *Index) Put(id string, name string, notes string) {
+	x.Delete(id)
+
+	weights := make(map[string]float64)
+	for _, word := range tokenize(name) {
+		weights[word] += nameWeight
+	}
+	for _, word := range tokenize(notes) {
+		weights[word] += notesWeight
+	}
+
+	if len(weights) == 0 {
+		return
+	}
+
+	words := make([]string, 0, len(weights))
+	for word, weight := range weights {
+		words = append(words, word)
+
+		if x.postings[word] == nil {
+			x.postings[word] = make(map[string]float64)
+			x.addWord(word)
+		}
+		x.postings[word][id] = weight
+	}
+
+	x.documents[id] = words
+}
+
+/*
+Delete takes a task out of the index.
+*/
+func (x *Index) Delete(id string) {
+	for _, word := range x.documents[id] {
+		delete(x.postings[word], id)
+
+		if len(x.postings[word]) == 0 {
+			delete(x.postings, word)
+			x.removeWord(word)
+		}
+	}
+
+	delete(x.documents, id)
+}
+
+/*
+Len returns the number of tasks indexed.
+*/
+func (x *Index) Len() int {
+	return len(x.documents)
+}
+
+/*
+Search finds the tasks containing every word of the query, best matches
+first (ties in ID order). Each word of the query matches any form of the
+word with the same stem, and any longer word it's the start of, so
+"deploy" finds "deploying" and "depl" finds "deployment".
+*/
+func (x *Index) Search(query string) []Result {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []Result{}
+	}
+
+	var scores map[string]float64
+	for _, term := range terms {
+		termScores := x.scoreTerm(term)
+
+		if scores == nil {
+			scores = termScores
+			continue
+		}
+
+		// Tasks have to match every term, so keep only the ones which
+		// matched this one too.
+		for id, score := range scores {
+			if termScore, ok := termScores[id]; ok {
+				scores[id] = score + termScore
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{ID: id, Score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	return results
+}
+
+/*
+scoreTerm scores every task matching a single search term. Each matching
+word counts for its weight in the task, damped so repeating a word over and
+over doesn't swamp everything else, and scaled up the rarer the word is.
+*/
+func (x *Index) scoreTerm(term string) map[string]float64 {
+	matches := make(map[string]float64)
+	for word := range x.stems[stem(term)] {
+		matches[word] = 1
+	}
+	for _, word := range x.wordsWithPrefix(term) {
+		if _, ok := matches[word]; !ok {
+			matches[word] = prefixWeight
+		}
+	}
+
+	documentCount := float64(len(x.documents))
+
+	scores := make(map[string]float64)
+	for word, matchWeight := range matches {
+		postings := x.postings[word]
+		idf := math.Log(1 + documentCount/float64(len(postings)))
+
+		for id, weight := range postings {
+			score := matchWeight * idf * weight / (weight + 1)
+			if score > scores[id] {
+				scores[id] = score
+			}
+		}
+	}
+
+	return scores
+}
+
+func (x *Index) wordsWithPrefix(prefix string) []string {
+	start := sort.SearchStrings(x.words, prefix)
+
+	end := start
+	for end < len(x.words) && strings.HasPrefix(x.words[end], prefix) {
+		end++
+	}
+
+	return x.words[start:end]
+}
+
+func (x *Index) addWord(word string) {
+	i := sort.SearchStrings(x.words, word)
+	x.words = append(x.words, "")
+	copy(x.words[i+1:], x.words[i:])
+	x.words[i] = word
+
+	wordStem := stem(word)
+	if x.stems[wordStem] == nil {
+		x.stems[wordStem] = make(map[string]bool)
+	}
+	x.stems[wordStem][word] = true
+}
+
+func (x *Index) removeWord(word string) {
+	i := sort.SearchStrings(x.words, word)
+	if i < len(x.words) && x.words[i] == word {
+		x.words = append(x.words[:i], x.words[i+1:]...)
+	}
+
+	wordStem := stem(word)
+	delete(x.stems[wordStem], word)
+	if len(x.stems[wordStem]) == 0 {
+		delete(x.stems, wordStem)
+	}
+}
@@ -0,0 +1,57 @@
+package fulltext
+
+import (
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	groups := [][]string{
+		{"deploy", "deploys", "deployed", "deploying"},
+		{"update", "updates", "updated", "updating"},
+		{"plan", "plans", "planned", "planning"},
+		{"library", "libraries"},
+	}
+
+	for _, group := range groups {
+		for _, word := range group[1:] {
+			if stem(word) != stem(group[0]) {
+				t.Errorf("Expected %v to stem like %v, got %v and %v", word, group[0], stem(word), stem(group[0]))
+			}
+		}
+	}
+
+	for _, word := range []string{"bring", "need", "status"} {
+		if stem(word) != word {
+			t.Errorf("Expected %v to be left alone, got %v", word, stem(word))
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	index := NewIndex()
+	index.Put("name", "Plan the deployment", "")
+	index.Put("notes", "Buy milk", "before planning the deployment")
+	index.Put("prefix", "Deployments dashboard", "")
+	index.Put("other", "Walk the dog", "")
+
+	results := index.Search("planned deployment")
+	if len(results) != 2 || results[0].ID != "name" || results[1].ID != "notes" {
+		t.Fatalf("Expected a name match to outrank a notes match, got %+v", results)
+	}
+
+	results = index.Search("deploy")
+	if len(results) != 3 {
+		t.Fatalf("Expected deploy to prefix match three tasks, got %+v", results)
+	}
+
+	index.Put("name", "Plan the party", "")
+	index.Delete("notes")
+
+	if results := index.Search("deployment"); len(results) != 1 || results[0].ID != "prefix" {
+		t.Fatalf("Expected changed and deleted tasks to drop out, got %+v", results)
+	}
+
+	if results := index.Search("   "); len(results) != 0 {
+		t.Fatalf("Expected an empty query to match nothing, got %+v", results)
+	}
+}
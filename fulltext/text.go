@@ -0,0 +1,75 @@
+package fulltext
+
+import (
+	"strings"
+	"unicode"
+)
+
+/*
+tokenize splits text into lower case words. Anything other than a letter or
+a digit separates words.
+*/
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+		return !unicode.IsLetter(c) && !unicode.IsDigit(c)
+	})
+}
+
+/*
+stem reduces an english word to its stem, so different forms of the same
+word ("deploy", "deploys", "deployed", "deploying") are found together. It
+only strips the most common inflections, leaving short words alone, and
+doesn't need to give real words as long as it's consistent.
+*/
+func stem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "ies"):
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"):
+	case strings.HasSuffix(word, "s"):
+		word = word[:len(word)-1]
+	}
+
+	for _, suffix := range []string{"ing", "ed"} {
+		trimmed := strings.TrimSuffix(word, suffix)
+		if trimmed == word || !hasVowel(trimmed) || len(trimmed) < 3 {
+			continue
+		}
+
+		word = trimmed
+		switch {
+		case strings.HasSuffix(word, "at"), strings.HasSuffix(word, "bl"), strings.HasSuffix(word, "iz"):
+			// "updat" -> "update", so it matches "updates" stemmed.
+			word += "e"
+		case hasDoubleConsonantEnding(word):
+			// "plann" -> "plan"
+			word = word[:len(word)-1]
+		}
+		break
+	}
+
+	if strings.HasSuffix(word, "ly") && len(word) > 5 {
+		word = word[:len(word)-2]
+	}
+
+	return strings.TrimSuffix(word, "e")
+}
+
+func hasVowel(word string) bool {
+	return strings.ContainsAny(word, "aeiouy")
+}
+
+func hasDoubleConsonantEnding(word string) bool {
+	n := len(word)
+	if n < 2 || word[n-1] != word[n-2] {
+		return false
+	}
+
+	return !strings.ContainsRune("aeioulsz", rune(word[n-1]))
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+DependencyParams is the json struct that gets passed in the request to make
+a task wait on another one.
+*/
+type DependencyParams struct {
+	BlockerID string `json:"blockerID"`
+}
+
+/*
+Validate checks the params name a blocker.
+*/
+func (p *DependencyParams) Validate() []task.Violation {
+	if p.BlockerID == "" {
+		return []task.Violation{{Field: "blockerID", Message: "blockerID is required"}}
+	}
+
+	return nil
+}
+
+/*
+DependenciesResponse lists the tasks a task is waiting on, and the tasks
+waiting on it.
+*/
+type DependenciesResponse struct {
+	BlockedBy []FlatTask `json:"blockedBy"`
+	Blocks    []FlatTask `json:"blocks"`
+}
+
+// TaskDependencies handles requests to the /tasks/{id}/dependencies endpoint.
+func TaskDependencies(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "GET":
+		handler = getDependencies
+	case "POST":
+		handler = postDependency
+	}
+
+	handler(response, request)
+}
+
+// TaskDependency handles requests to the /tasks/{id}/dependencies/{blockerID}
+// endpoint.
+func TaskDependency(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "DELETE":
+		handler = deleteDependency
+	}
+
+	handler(response, request)
+}
+
+func getDependencies(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+
+	err := store.View(func(tasklist *task.Tasklist) error {
+		t, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		rollUps := task.NewRollUps(time.Now())
+		dependencies := DependenciesResponse{
+			BlockedBy: []FlatTask{},
+			Blocks:    []FlatTask{},
+		}
+		for _, blocker := range t.BlockedBy {
+			dependencies.BlockedBy = append(dependencies.BlockedBy, newFlatTask(blocker, rollUps))
+		}
+		for _, waiting := range t.Blocks {
+			dependencies.Blocks = append(dependencies.Blocks, newFlatTask(waiting, rollUps))
+		}
+
+		WriteJSONResponse(response, dependencies, http.StatusOK)
+
+		return nil
+	})
+	if err != nil {
+		writeError(err, response, request)
+	}
+}
+
+/*
+postDependency makes the task wait on the blocker named in the request, as
+long as the task still matches the request's If-Match header.
+*/
+func postDependency(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	var params DependencyParams
+	if err := decodeBody(request, &params); err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+
+	err := store.Update(getMutation(request, taskID), func(tasklist *task.Tasklist) error {
+		t, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		if ifMatchFails(request, taskETag(t.Revision)) {
+			return errPreconditionFailed
+		}
+
+		blocker, ok := tasklist.Registry[params.BlockerID]
+		if !ok {
+			return fieldTaskNotFound("blockerID", params.BlockerID)
+		}
+
+		return t.AddBlocker(blocker)
+	})
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteBasicResponse(http.StatusOK, response)
+}
+
+/*
+deleteDependency stops the task waiting on the blocker, as long as the task
+still matches the request's If-Match header.
+*/
+func deleteDependency(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+	blockerID := vars["blockerID"]
+
+	err := store.Update(getMutation(request, taskID), func(tasklist *task.Tasklist) error {
+		t, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		if ifMatchFails(request, taskETag(t.Revision)) {
+			return errPreconditionFailed
+		}
+
+		if !t.IsBlockedBy(blockerID) {
+			return newRequestError(http.StatusNotFound, CodeNotADependency, "", "Task '%v' isn't waiting on task '%v'", taskID, blockerID)
+		}
+
+		t.RemoveBlocker(tasklist.Registry[blockerID])
+
+		return nil
+	})
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteBasicResponse(http.StatusOK, response)
+}
@@ -0,0 +1,340 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jeffbmartinez/log"
+
+	"github.com/jeffbmartinez/todo-persistence/schedule"
+	"github.com/jeffbmartinez/todo-persistence/storage"
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+Error codes, telling clients what went wrong in a way that doesn't depend on
+the wording of the message.
+*/
+const (
+	CodeMethodNotAllowed     = "method_not_allowed"
+	CodeMissingBody          = "missing_body"
+	CodeMalformedJSON        = "malformed_json"
+	CodeInvalidField         = "invalid_field"
+	CodeValidationFailed     = "validation_failed"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeInvalidPatch         = "invalid_patch"
+	CodePatchTestFailed      = "patch_test_failed"
+	CodeInvalidQuery         = "invalid_query"
+	CodeListNotFound         = "list_not_found"
+	CodeTaskNotFound         = "task_not_found"
+	CodeUnableToCreateTask   = "unable_to_create_task"
+	CodeCycle                = "cycle"
+	CodeDependencyCycle      = "dependency_cycle"
+	CodeBlocked              = "blocked"
+	CodeNotADependency       = "not_a_dependency"
+	CodeTimerRunning         = "timer_running"
+	CodeTimerNotRunning      = "timer_not_running"
+	CodeNotAParent           = "not_a_parent"
+	CodePreconditionFailed   = "precondition_failed"
+	CodeSnapshotNotFound     = "snapshot_not_found"
+	CodeSnapshotsDisabled    = "snapshots_disabled"
+	CodeHistoryNotFound      = "history_not_found"
+	CodeAuditLogDisabled     = "audit_log_disabled"
+	CodeSearchDisabled       = "search_disabled"
+	CodeNothingToUndo        = "nothing_to_undo"
+	CodeNothingToRedo        = "nothing_to_redo"
+	CodeInternalError        = "internal_error"
+)
+
+/*
+ErrorResponse is the json body of every error response.
+*/
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	/*
+		Field names the request field which caused the error, when the
+		error was down to a single field.
+	*/
+	Field string `json:"field,omitempty"`
+
+	/*
+		Violations lists every problem found with the request's fields, when
+		it failed validation.
+	*/
+	Violations []task.Violation `json:"violations,omitempty"`
+
+	/*
+		RequestID is the ID the request was logged under, also sent back in
+		the X-Request-ID header.
+	*/
+	RequestID string `json:"requestID"`
+}
+
+/*
+requestError can be returned from inside a storage view or update to
+abandon it and respond to the request with an error.
+*/
+type requestError struct {
+	statusCode int
+	code       string
+	field      string
+	message    string
+	violations []task.Violation
+}
+
+func newRequestError(statusCode int, code string, field string, format string, args ...interface{}) requestError {
+	return requestError{
+		statusCode: statusCode,
+		code:       code,
+		field:      field,
+		message:    fmt.Sprintf(format, args...),
+	}
+}
+
+func (e requestError) Error() string {
+	return e.message
+}
+
+var errMissingBody = newRequestError(http.StatusBadRequest, CodeMissingBody, "", "The request has no body")
+var errPreconditionFailed = newRequestError(http.StatusPreconditionFailed, CodePreconditionFailed, "", "The task has changed since the supplied ETag")
+
+/*
+taskNotFound is the error for a task named in the request's path which
+doesn't exist.
+*/
+func taskNotFound(taskID string) requestError {
+	return newRequestError(http.StatusNotFound, CodeTaskNotFound, "", "%v", task.NewNotFoundError(taskID))
+}
+
+/*
+fieldTaskNotFound is the error for a task named in a field of the request
+body which doesn't exist. It's the request which is wrong rather than the
+resource missing, so it's a bad request rather than not found.
+*/
+func fieldTaskNotFound(field string, taskID string) requestError {
+	return newRequestError(http.StatusBadRequest, CodeTaskNotFound, field, "%v", task.NewNotFoundError(taskID))
+}
+
+/*
+validator is implemented by request params with validation rules of their
+own. Validate normalizes the params and returns every rule they break.
+*/
+type validator interface {
+	Validate() []task.Violation
+}
+
+/*
+validateFields normalizes the name, recurrence and categories of a task in
+place, and returns every validation rule they (or the other fields) break.
+*/
+func validateFields(name *string, notes string, priority int, recurrence *string, dueDate int64, estimate int64, categories *[]string) []task.Violation {
+	fields := task.Fields{
+		Name:       *name,
+		Notes:      notes,
+		Priority:   priority,
+		Recurrence: *recurrence,
+		DueDate:    dueDate,
+		Estimate:   estimate,
+		Categories: *categories,
+	}
+	fields.Normalize()
+
+	*name, *recurrence, *categories = fields.Name, fields.Recurrence, fields.Categories
+
+	return fields.Violations()
+}
+
+/*
+decodeBody decodes the json body of a request into params, a pointer to a
+struct, returning a requestError describing what was wrong with it if it
+can't. See decodeJSON.
+*/
+func decodeBody(request *http.Request, params interface{}) error {
+	if request.Body == nil {
+		return errMissingBody
+	}
+
+	defer request.Body.Close()
+	contents, err := ioutil.ReadAll(request.Body)
+	if err != nil {
+		return newRequestError(http.StatusBadRequest, CodeMissingBody, "", "Couldn't read the request body (%v)", err)
+	}
+
+	return decodeJSON(contents, params)
+}
+
+/*
+decodeJSON decodes json into params, a pointer to a struct. Fields params
+doesn't have are rejected rather than ignored. If params is a validator,
+it's validated too. Unknown fields and broken validation rules are all
+listed together in a single ValidationError.
+*/
+func decodeJSON(contents []byte, params interface{}) error {
+	if len(bytes.TrimSpace(contents)) == 0 {
+		return errMissingBody
+	}
+
+	if err := json.Unmarshal(contents, params); err != nil {
+		return decodeError(err)
+	}
+
+	violations := []task.Violation{}
+	for _, field := range unknownFields(contents, params) {
+		violations = append(violations, task.Violation{
+			Field:   field,
+			Message: fmt.Sprintf("%v isn't a known field", field),
+		})
+	}
+
+	if validator, ok := params.(validator); ok {
+		violations = append(violations, validator.Validate()...)
+	}
+
+	if len(violations) > 0 {
+		return task.ValidationError{
+			Violations: violations,
+		}
+	}
+
+	return nil
+}
+
+/*
+unknownFields returns the members of a json object which don't match any
+field of params, a pointer to a struct, in sorted order.
+*/
+func unknownFields(contents []byte, params interface{}) []string {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &members); err != nil {
+		return nil
+	}
+
+	known := make(map[string]bool)
+	paramsType := reflect.TypeOf(params).Elem()
+	for i := 0; i < paramsType.NumField(); i++ {
+		name := strings.Split(paramsType.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = paramsType.Field(i).Name
+		}
+
+		// encoding/json matches field names case insensitively.
+		known[strings.ToLower(name)] = true
+	}
+
+	unknown := []string{}
+	for member := range members {
+		if !known[strings.ToLower(member)] {
+			unknown = append(unknown, member)
+		}
+	}
+	sort.Strings(unknown)
+
+	return unknown
+}
+
+/*
+decodeError describes why a request body couldn't be decoded.
+*/
+func decodeError(err error) requestError {
+	if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+		return newRequestError(http.StatusBadRequest, CodeInvalidField, typeErr.Field, "Expected %v to be a json %v, not %v", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+
+	if err == io.EOF {
+		return errMissingBody
+	}
+
+	return newRequestError(http.StatusBadRequest, CodeMalformedJSON, "", "The request body isn't valid json (%v)", err)
+}
+
+/*
+getRequestError describes any error met while handling a request as a
+requestError, so it can be written out.
+*/
+func getRequestError(err error) requestError {
+	switch err := err.(type) {
+	case requestError:
+		return err
+	case task.NotFoundError:
+		return newRequestError(http.StatusNotFound, CodeTaskNotFound, "", "%v", err)
+	case task.UnableToCreateTaskError:
+		return newRequestError(http.StatusBadRequest, CodeUnableToCreateTask, err.Field(), "%v", err)
+	case task.CycleError:
+		return newRequestError(http.StatusConflict, CodeCycle, "", "%v", err)
+	case task.DependencyCycleError:
+		return newRequestError(http.StatusConflict, CodeDependencyCycle, "", "%v", err)
+	case schedule.CycleError:
+		return newRequestError(http.StatusConflict, CodeDependencyCycle, "", "%v", err)
+	case task.TimerRunningError:
+		return newRequestError(http.StatusConflict, CodeTimerRunning, "", "%v", err)
+	case task.TimerNotRunningError:
+		return newRequestError(http.StatusConflict, CodeTimerNotRunning, "", "%v", err)
+	case task.BlockedError:
+		return newRequestError(http.StatusConflict, CodeBlocked, "", "%v, complete them first or add force=true", err)
+	case task.ValidationError:
+		requestErr := newRequestError(http.StatusBadRequest, CodeValidationFailed, "", "%v", err)
+		requestErr.violations = err.Violations
+		if len(err.Violations) == 1 {
+			requestErr.field = err.Violations[0].Field
+		}
+		return requestErr
+	}
+
+	switch err {
+	case storage.ErrInvalidListName:
+		return newRequestError(http.StatusNotFound, CodeListNotFound, "", "%v", err)
+	case storage.ErrSnapshotNotFound:
+		return newRequestError(http.StatusNotFound, CodeSnapshotNotFound, "", "%v", err)
+	case storage.ErrSnapshotsDisabled:
+		return newRequestError(http.StatusNotFound, CodeSnapshotsDisabled, "", "%v", err)
+	case storage.ErrAuditLogDisabled:
+		return newRequestError(http.StatusNotFound, CodeAuditLogDisabled, "", "%v", err)
+	case storage.ErrSearchDisabled:
+		return newRequestError(http.StatusNotFound, CodeSearchDisabled, "", "%v", err)
+	case storage.ErrNothingToUndo:
+		return newRequestError(http.StatusConflict, CodeNothingToUndo, "", "%v", err)
+	case storage.ErrNothingToRedo:
+		return newRequestError(http.StatusConflict, CodeNothingToRedo, "", "%v", err)
+	}
+
+	return newRequestError(http.StatusInternalServerError, CodeInternalError, "", "%v", http.StatusText(http.StatusInternalServerError))
+}
+
+/*
+writeError responds to a request with the error envelope describing err.
+Errors which aren't the client's fault are logged, and their details are
+kept out of the response.
+*/
+func writeError(err error, response http.ResponseWriter, request *http.Request) {
+	requestErr := getRequestError(err)
+	requestID := getRequestID(response, request)
+
+	if requestErr.statusCode >= 500 {
+		log.Errorf("Request %v failed (%v)", requestID, err)
+	}
+
+	WriteJSONResponse(response, ErrorResponse{
+		Code:       requestErr.code,
+		Message:    requestErr.message,
+		Field:      requestErr.field,
+		Violations: requestErr.violations,
+		RequestID:  requestID,
+	}, requestErr.statusCode)
+}
+
+/*
+methodNotAllowed is the handler for requests using a method an endpoint
+doesn't support.
+*/
+func methodNotAllowed(response http.ResponseWriter, request *http.Request) {
+	writeError(newRequestError(http.StatusMethodNotAllowed, CodeMethodNotAllowed, "", "%v isn't supported here", request.Method), response, request)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+/*
+taskETag returns the entity tag for a revision of a task.
+*/
+func taskETag(revision int64) string {
+	return fmt.Sprintf(`"%v"`, revision)
+}
+
+/*
+ifMatchFails returns true if the request has an If-Match header which
+doesn't match the current entity tag, meaning the client is about to change
+something it hasn't seen the latest version of.
+*/
+func ifMatchFails(request *http.Request, etag string) bool {
+	header := request.Header.Get("If-Match")
+	if header == "" {
+		return false
+	}
+
+	return !matchesETag(header, etag)
+}
+
+/*
+matchesETag returns true if any of the comma separated entity tags in a
+request header (or "*") matches etag. Weak tags are compared as if they
+were strong, every tag this server hands out is strong.
+*/
+func matchesETag(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
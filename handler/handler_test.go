@@ -0,0 +1,962 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/jeffbmartinez/todo-persistence/storage"
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+testTask is the part of a task response the tests look at.
+*/
+type testTask struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Notes      string     `json:"notes"`
+	Priority   int        `json:"priority"`
+	Complete   bool       `json:"complete"`
+	Categories []string   `json:"categories"`
+	ParentIDs  []string   `json:"parentIDs"`
+	SubtaskIDs []string   `json:"subtaskIDs"`
+	Subtasks   []testTask `json:"subtasks"`
+}
+
+/*
+testResponse is a response read in full, so the body can be looked at after
+the connection is gone.
+*/
+type testResponse struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+/*
+newTestServer serves every endpoint from a fresh in memory list, routed and
+given request IDs the same way the real server does. Lists keep snapshots,
+an audit log, undo history and a search index, as they do in the real
+server, with the files under a temporary directory.
+*/
+func newTestServer(t *testing.T) *httptest.Server {
+	dir, err := ioutil.TempDir("", "todo-handler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	UseLists(storage.NewLists(func(listName string) (*storage.Store, error) {
+		store, err := storage.Open(storage.NewMemory())
+		if err != nil {
+			return nil, err
+		}
+
+		store.KeepSnapshots(storage.NewSnapshots(filepath.Join(dir, "snapshots", listName), storage.SnapshotPolicy{Interval: time.Hour}))
+		store.KeepAuditLog(storage.NewAuditLog(filepath.Join(dir, "audit", listName+".log")))
+		store.KeepUndoHistory(10)
+		store.KeepSearchIndex()
+		return store, nil
+	}))
+
+	router := mux.NewRouter()
+	addTestRoutes(router)
+	addTestRoutes(router.PathPrefix("/lists/{list}").Subrouter())
+
+	return httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		RequestIDMiddleware{}.ServeHTTP(response, request, router.ServeHTTP)
+	}))
+}
+
+/*
+addTestRoutes adds the same routes as the server's addListRoutes.
+*/
+func addTestRoutes(router *mux.Router) {
+	router.HandleFunc("/tasks", Tasks)
+	router.HandleFunc("/tasks/new", NewTask)
+	router.HandleFunc("/tasks/search", SearchTasks)
+	router.HandleFunc("/tasks/next", NextTasks)
+	router.HandleFunc("/tasks/{id}", Task)
+	router.HandleFunc("/tasks/{id}/history", TaskHistory)
+	router.HandleFunc("/tasks/{id}/move", MoveTask)
+	router.HandleFunc("/tasks/{id}/schedule", TaskSchedule)
+	router.HandleFunc("/tasks/{id}/timer/start", StartTimer)
+	router.HandleFunc("/tasks/{id}/timer/stop", StopTimer)
+	router.HandleFunc("/tasks/{id}/dependencies", TaskDependencies)
+	router.HandleFunc("/tasks/{id}/dependencies/{blockerID}", TaskDependency)
+
+	router.HandleFunc("/search", TextSearch)
+
+	router.HandleFunc("/undo", Undo)
+	router.HandleFunc("/redo", Redo)
+
+	router.HandleFunc("/admin/snapshots", Snapshots)
+	router.HandleFunc("/admin/restore", Restore)
+}
+
+/*
+send makes a request to the test server, with headers given as name, value
+pairs.
+*/
+func send(t *testing.T, server *httptest.Server, method string, path string, body string, headers ...string) testResponse {
+	t.Helper()
+
+	request, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		request.Header.Set(headers[i], headers[i+1])
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	contents, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testResponse{statusCode: response.StatusCode, header: response.Header, body: contents}
+}
+
+/*
+expectStatus fails the test unless the response has the expected status.
+*/
+func expectStatus(t *testing.T, response testResponse, statusCode int) {
+	t.Helper()
+
+	if response.statusCode != statusCode {
+		t.Fatalf("Expected status %v, got %v (%s)", statusCode, response.statusCode, response.body)
+	}
+}
+
+/*
+expectError fails the test unless the response is an error envelope with
+the expected status and code, and returns the envelope.
+*/
+func expectError(t *testing.T, response testResponse, statusCode int, code string) ErrorResponse {
+	t.Helper()
+
+	expectStatus(t, response, statusCode)
+
+	var errorResponse ErrorResponse
+	if err := json.Unmarshal(response.body, &errorResponse); err != nil {
+		t.Fatalf("Error response isn't an error envelope (%v): %s", err, response.body)
+	}
+
+	if errorResponse.Code != code {
+		t.Fatalf("Expected code %v, got %v (%v)", code, errorResponse.Code, errorResponse.Message)
+	}
+	if errorResponse.Message == "" {
+		t.Errorf("Error response should have a message")
+	}
+	if errorResponse.RequestID == "" || errorResponse.RequestID != response.header.Get(requestIDHeader) {
+		t.Errorf("Error response should carry the request ID from the %v header (%v), got '%v'", requestIDHeader, response.header.Get(requestIDHeader), errorResponse.RequestID)
+	}
+
+	return errorResponse
+}
+
+/*
+decodeResponse decodes the response body into v, failing the test if it can't.
+*/
+func decodeResponse(t *testing.T, response testResponse, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(response.body, v); err != nil {
+		t.Fatalf("Couldn't decode response into %T (%v): %s", v, err, response.body)
+	}
+}
+
+func decodeTask(t *testing.T, response testResponse) testTask {
+	t.Helper()
+
+	var decoded testTask
+	if err := json.Unmarshal(response.body, &decoded); err != nil {
+		t.Fatalf("Response isn't a task (%v): %s", err, response.body)
+	}
+
+	return decoded
+}
+
+func decodeTasks(t *testing.T, response testResponse) []testTask {
+	t.Helper()
+
+	var decoded []testTask
+	if err := json.Unmarshal(response.body, &decoded); err != nil {
+		t.Fatalf("Response isn't a list of tasks (%v): %s", err, response.body)
+	}
+
+	return decoded
+}
+
+func taskNames(tasks []testTask) string {
+	names := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		names = append(names, t.Name)
+	}
+
+	return strings.Join(names, ",")
+}
+
+/*
+createTask makes a task with the supplied json fields and returns it.
+*/
+func createTask(t *testing.T, server *httptest.Server, fields string) testTask {
+	t.Helper()
+
+	response := send(t, server, "POST", "/tasks/new", fields)
+	expectStatus(t, response, http.StatusOK)
+
+	return decodeTask(t, response)
+}
+
+/*
+getTestTask fetches a task in the flat view, which lists its parents as
+well as its subtasks.
+*/
+func getTestTask(t *testing.T, server *httptest.Server, taskID string) testTask {
+	t.Helper()
+
+	response := send(t, server, "GET", "/tasks/"+taskID+"?flat=true", "")
+	expectStatus(t, response, http.StatusOK)
+
+	return decodeTasks(t, response)[0]
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		statusCode int
+		code       string
+		field      string
+	}{
+		{"unsupported method", "DELETE", "/tasks", "", http.StatusMethodNotAllowed, CodeMethodNotAllowed, ""},
+		{"no body", "POST", "/tasks/new", "", http.StatusBadRequest, CodeMissingBody, ""},
+		{"broken json", "POST", "/tasks/new", "{", http.StatusBadRequest, CodeMalformedJSON, ""},
+		{"wrong json type", "POST", "/tasks/new", `{"name": 5}`, http.StatusBadRequest, CodeInvalidField, "name"},
+		{"missing task", "GET", "/tasks/nope", "", http.StatusNotFound, CodeTaskNotFound, ""},
+		{"missing parent", "POST", "/tasks/new", `{"name": "a", "parentIDs": ["nope"]}`, http.StatusBadRequest, CodeUnableToCreateTask, "parentIDs"},
+		{"bad list name", "GET", "/lists/bad.name/tasks", "", http.StatusNotFound, CodeListNotFound, ""},
+		{"bad query", "GET", "/tasks?limit=0", "", http.StatusBadRequest, CodeValidationFailed, "limit"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errorResponse := expectError(t, send(t, server, test.method, test.path, test.body), test.statusCode, test.code)
+			if errorResponse.Field != test.field {
+				t.Errorf("Expected field '%v', got '%v'", test.field, errorResponse.Field)
+			}
+		})
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	response := send(t, server, "GET", "/tasks/nope", "", requestIDHeader, "client-chosen-1")
+	if errorResponse := expectError(t, response, http.StatusNotFound, CodeTaskNotFound); errorResponse.RequestID != "client-chosen-1" {
+		t.Errorf("Expected the client's request ID to be used, got '%v'", errorResponse.RequestID)
+	}
+
+	first := send(t, server, "GET", "/tasks", "").header.Get(requestIDHeader)
+	second := send(t, server, "GET", "/tasks", "").header.Get(requestIDHeader)
+	if first == "" || first == second {
+		t.Errorf("Every request should be given its own ID, got '%v' and '%v'", first, second)
+	}
+
+	response = send(t, server, "GET", "/tasks", "", requestIDHeader, "has spaces in it")
+	if got := response.header.Get(requestIDHeader); got == "" || got == "has spaces in it" {
+		t.Errorf("An unsafe request ID should be replaced, got '%v'", got)
+	}
+}
+
+func TestCycleAndNotFoundMapping(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	parent := createTask(t, server, `{"name": "parent"}`)
+	child := createTask(t, server, `{"name": "child", "parentIDs": ["`+parent.ID+`"]}`)
+
+	response := send(t, server, "PATCH", "/tasks/"+parent.ID, `{"parentIDs": ["`+child.ID+`"]}`)
+	expectError(t, response, http.StatusConflict, CodeCycle)
+
+	if got := getTestTask(t, server, parent.ID); len(got.ParentIDs) != 0 {
+		t.Errorf("A refused update should change nothing, parent now has parents %v", got.ParentIDs)
+	}
+
+	// The parent already waits on its subtask, so the subtask can't wait on
+	// it.
+	response = send(t, server, "POST", "/tasks/"+child.ID+"/dependencies", `{"blockerID": "`+parent.ID+`"}`)
+	expectError(t, response, http.StatusConflict, CodeDependencyCycle)
+
+	response = send(t, server, "PATCH", "/tasks/nope", `{"name": "x"}`)
+	expectError(t, response, http.StatusNotFound, CodeTaskNotFound)
+
+	response = send(t, server, "PATCH", "/tasks/"+parent.ID, `{"subtaskIDs": ["nope"]}`)
+	if errorResponse := expectError(t, response, http.StatusBadRequest, CodeTaskNotFound); errorResponse.Field != "subtaskIDs" {
+		t.Errorf("Expected the missing subtask to be blamed on subtaskIDs, got '%v'", errorResponse.Field)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	created := createTask(t, server, `{"name": "task"}`)
+
+	response := send(t, server, "GET", "/tasks/"+created.ID, "")
+	etag := response.header.Get("ETag")
+	if etag == "" {
+		t.Fatal("A task should have an ETag")
+	}
+
+	response = send(t, server, "GET", "/tasks/"+created.ID, "", "If-None-Match", etag)
+	expectStatus(t, response, http.StatusOK)
+
+	response = send(t, server, "PUT", "/tasks/"+created.ID, `{"name": "renamed"}`, "If-Match", etag)
+	expectStatus(t, response, http.StatusOK)
+
+	response = send(t, server, "PUT", "/tasks/"+created.ID, `{"name": "lost update"}`, "If-Match", etag)
+	expectError(t, response, http.StatusPreconditionFailed, CodePreconditionFailed)
+
+	response = send(t, server, "DELETE", "/tasks/"+created.ID, "", "If-Match", etag)
+	expectError(t, response, http.StatusPreconditionFailed, CodePreconditionFailed)
+
+	if got := getTestTask(t, server, created.ID); got.Name != "renamed" {
+		t.Errorf("Updates with a stale ETag should be refused, name is now '%v'", got.Name)
+	}
+
+	// Listed tasks carry roll-ups which change while timers run, so the
+	// list is never answered with a 304.
+	response = send(t, server, "GET", "/tasks", "", "If-None-Match", "*")
+	expectStatus(t, response, http.StatusOK)
+	if etag := response.header.Get("ETag"); etag != "" {
+		t.Errorf("Expected no ETag on the list of tasks, got %v", etag)
+	}
+}
+
+func TestDependenciesCheckIfMatch(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	blocked := createTask(t, server, `{"name": "blocked"}`)
+	blocker := createTask(t, server, `{"name": "blocker"}`)
+	path := "/tasks/" + blocked.ID + "/dependencies"
+
+	stale := send(t, server, "GET", "/tasks/"+blocked.ID, "").header.Get("ETag")
+	expectStatus(t, send(t, server, "PATCH", "/tasks/"+blocked.ID, `{"name": "renamed"}`), http.StatusOK)
+
+	response := send(t, server, "POST", path, `{"blockerID": "`+blocker.ID+`"}`, "If-Match", stale)
+	expectError(t, response, http.StatusPreconditionFailed, CodePreconditionFailed)
+
+	etag := send(t, server, "GET", "/tasks/"+blocked.ID, "").header.Get("ETag")
+	response = send(t, server, "POST", path, `{"blockerID": "`+blocker.ID+`"}`, "If-Match", etag)
+	expectStatus(t, response, http.StatusOK)
+
+	// Waiting on the blocker changed the task, so the ETag it was added
+	// with is stale now too.
+	response = send(t, server, "DELETE", path+"/"+blocker.ID, "", "If-Match", etag)
+	expectError(t, response, http.StatusPreconditionFailed, CodePreconditionFailed)
+
+	etag = send(t, server, "GET", "/tasks/"+blocked.ID, "").header.Get("ETag")
+	response = send(t, server, "DELETE", path+"/"+blocker.ID, "", "If-Match", etag)
+	expectStatus(t, response, http.StatusOK)
+}
+
+/*
+A task's ETag is its own revision, which doesn't change when a subtask
+does, so a GET of the task must never answer 304 with the old subtree.
+*/
+func TestGetTaskIgnoresIfNoneMatch(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	parent := createTask(t, server, `{"name": "parent"}`)
+	child := createTask(t, server, `{"name": "child", "parentIDs": ["`+parent.ID+`"]}`)
+
+	etag := send(t, server, "GET", "/tasks/"+parent.ID, "").header.Get("ETag")
+
+	expectStatus(t, send(t, server, "PATCH", "/tasks/"+child.ID, `{"name": "renamed"}`), http.StatusOK)
+
+	response := send(t, server, "GET", "/tasks/"+parent.ID, "", "If-None-Match", etag)
+	expectStatus(t, response, http.StatusOK)
+
+	if got := decodeTask(t, response); len(got.Subtasks) != 1 || got.Subtasks[0].Name != "renamed" {
+		t.Errorf("Expected the renamed subtask, got %+v", got.Subtasks)
+	}
+}
+
+func TestPatchAndPut(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	parent := createTask(t, server, `{"name": "parent"}`)
+	created := createTask(t, server, `{"name": "task", "notes": "some notes", "priority": 1, "categories": ["work"], "parentIDs": ["`+parent.ID+`"]}`)
+
+	// Merge patches leave out what they don't change.
+	response := send(t, server, "PATCH", "/tasks/"+created.ID, `{"priority": 3, "notes": null}`, "Content-Type", mergePatchMediaType)
+	expectStatus(t, response, http.StatusOK)
+
+	got := getTestTask(t, server, created.ID)
+	if got.Name != "task" || got.Priority != 3 || got.Notes != "" || !reflect.DeepEqual(got.Categories, []string{"work"}) {
+		t.Errorf("Merge patch should only change priority and clear notes, got %+v", got)
+	}
+
+	// JSON Patches change single values, and can test them first.
+	response = send(t, server, "PATCH", "/tasks/"+created.ID, `[{"op": "test", "path": "/priority", "value": 3}, {"op": "add", "path": "/categories/-", "value": "home"}]`, "Content-Type", jsonPatchMediaType)
+	expectStatus(t, response, http.StatusOK)
+
+	if got := getTestTask(t, server, created.ID); !reflect.DeepEqual(got.Categories, []string{"work", "home"}) {
+		t.Errorf("JSON Patch should add a category, got %v", got.Categories)
+	}
+
+	response = send(t, server, "PATCH", "/tasks/"+created.ID, `[{"op": "test", "path": "/priority", "value": 1}]`, "Content-Type", jsonPatchMediaType)
+	expectError(t, response, http.StatusConflict, CodePatchTestFailed)
+
+	response = send(t, server, "PATCH", "/tasks/"+created.ID, `[{"op": "bogus"}]`, "Content-Type", jsonPatchMediaType)
+	expectError(t, response, http.StatusBadRequest, CodeInvalidPatch)
+
+	response = send(t, server, "PATCH", "/tasks/"+created.ID, "name=x", "Content-Type", "text/plain")
+	expectError(t, response, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType)
+
+	// A PUT replaces everything, clearing whatever it leaves out, parents
+	// included.
+	response = send(t, server, "PUT", "/tasks/"+created.ID, `{"name": "replaced"}`)
+	expectStatus(t, response, http.StatusOK)
+
+	got = getTestTask(t, server, created.ID)
+	if got.Name != "replaced" || got.Priority != 0 || len(got.Categories) != 0 {
+		t.Errorf("PUT should replace every field, got %+v", got)
+	}
+
+	if got := getTestTask(t, server, parent.ID); len(got.SubtaskIDs) != 0 {
+		t.Errorf("PUT without parentIDs should unlink the task from its parent, parent still has %v", got.SubtaskIDs)
+	}
+
+	tasks := decodeTasks(t, send(t, server, "GET", "/tasks?sort=name", ""))
+	if names := taskNames(tasks); names != "parent,replaced" {
+		t.Errorf("The unlinked task should be a root task, root tasks are %v", names)
+	}
+}
+
+func TestPutKeepsCompletionAsSent(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	parent := createTask(t, server, `{"name": "parent"}`)
+	done := createTask(t, server, `{"name": "done", "parentIDs": ["`+parent.ID+`"]}`)
+	open := createTask(t, server, `{"name": "open", "parentIDs": ["`+parent.ID+`"]}`)
+	expectStatus(t, send(t, server, "PATCH", "/tasks/"+done.ID, `{"complete": true}`), http.StatusOK)
+
+	// Dropping the only incomplete subtask would complete the parent, but
+	// the PUT says it isn't complete.
+	response := send(t, server, "PUT", "/tasks/"+parent.ID, `{"name": "parent", "complete": false, "subtaskIDs": ["`+done.ID+`"]}`)
+	expectStatus(t, response, http.StatusOK)
+
+	if got := getTestTask(t, server, parent.ID); got.Complete || !reflect.DeepEqual(got.SubtaskIDs, []string{done.ID}) {
+		t.Errorf("Expected the parent incomplete with only the done subtask, got complete=%v and subtasks %v", got.Complete, got.SubtaskIDs)
+	}
+
+	// Adding an incomplete subtask would reopen the parent, but the PUT says
+	// it's complete.
+	response = send(t, server, "PUT", "/tasks/"+parent.ID, `{"name": "parent", "complete": true, "subtaskIDs": ["`+done.ID+`", "`+open.ID+`"]}`)
+	expectStatus(t, response, http.StatusOK)
+
+	if got := getTestTask(t, server, parent.ID); !got.Complete || len(got.SubtaskIDs) != 2 {
+		t.Errorf("Expected the parent complete with both subtasks, got complete=%v and subtasks %v", got.Complete, got.SubtaskIDs)
+	}
+}
+
+func TestMoveTask(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	from := createTask(t, server, `{"name": "from"}`)
+	to := createTask(t, server, `{"name": "to"}`)
+	other := createTask(t, server, `{"name": "other"}`)
+	moving := createTask(t, server, `{"name": "moving", "parentIDs": ["`+from.ID+`"]}`)
+
+	response := send(t, server, "POST", "/tasks/"+moving.ID+"/move", `{"from": "`+from.ID+`", "to": "`+to.ID+`"}`)
+	expectStatus(t, response, http.StatusOK)
+
+	if got := getTestTask(t, server, moving.ID); !reflect.DeepEqual(got.ParentIDs, []string{to.ID}) {
+		t.Errorf("Expected the task to be under %v only, got %v", to.ID, got.ParentIDs)
+	}
+
+	response = send(t, server, "POST", "/tasks/"+moving.ID+"/move", `{"from": "`+other.ID+`", "to": "`+from.ID+`"}`)
+	if errorResponse := expectError(t, response, http.StatusConflict, CodeNotAParent); errorResponse.Field != "from" {
+		t.Errorf("Expected the error to be blamed on from, got '%v'", errorResponse.Field)
+	}
+
+	response = send(t, server, "POST", "/tasks/"+moving.ID+"/move", `{"from": "`+to.ID+`", "to": "nope"}`)
+	expectError(t, response, http.StatusBadRequest, CodeTaskNotFound)
+
+	response = send(t, server, "POST", "/tasks/"+to.ID+"/move", `{"to": "`+moving.ID+`"}`)
+	expectError(t, response, http.StatusConflict, CodeCycle)
+
+	response = send(t, server, "POST", "/tasks/"+moving.ID+"/move", `{}`)
+	expectError(t, response, http.StatusBadRequest, CodeInvalidField)
+
+	// Moving out to the root tasks.
+	response = send(t, server, "POST", "/tasks/"+moving.ID+"/move", `{"from": "`+to.ID+`"}`)
+	expectStatus(t, response, http.StatusOK)
+
+	if got := getTestTask(t, server, moving.ID); len(got.ParentIDs) != 0 {
+		t.Errorf("Expected the task to be a root task, got parents %v", got.ParentIDs)
+	}
+}
+
+func TestValidationViolations(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	response := send(t, server, "POST", "/tasks/new", `{"name": " ", "dueDate": -4, "colour": "red"}`)
+	errorResponse := expectError(t, response, http.StatusBadRequest, CodeValidationFailed)
+
+	fields := make(map[string]bool)
+	for _, violation := range errorResponse.Violations {
+		fields[violation.Field] = true
+	}
+	for _, field := range []string{"name", "dueDate", "colour"} {
+		if !fields[field] {
+			t.Errorf("Expected a violation for %v, got %+v", field, errorResponse.Violations)
+		}
+	}
+	if errorResponse.Field != "" {
+		t.Errorf("Several violations shouldn't be blamed on a single field, got '%v'", errorResponse.Field)
+	}
+
+	created := createTask(t, server, `{"name": " task ", "categories": ["Work", "work "]}`)
+	if created.Name != "task" || !reflect.DeepEqual(created.Categories, []string{"work"}) {
+		t.Errorf("Expected the name and categories to be normalized, got %+v", created)
+	}
+
+	response = send(t, server, "PATCH", "/tasks/"+created.ID, `{"bogus": 1}`)
+	errorResponse = expectError(t, response, http.StatusBadRequest, CodeValidationFailed)
+	if errorResponse.Field != "bogus" || len(errorResponse.Violations) != 1 {
+		t.Errorf("Expected only the unknown field to be rejected, got %+v", errorResponse)
+	}
+
+	response = send(t, server, "PUT", "/tasks/"+created.ID, `{"name": "x", "subtasks": []}`)
+	expectError(t, response, http.StatusBadRequest, CodeValidationFailed)
+}
+
+func TestFilteringAndPagination(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	for _, name := range []string{"e", "c", "a", "d", "b"} {
+		createTask(t, server, `{"name": "`+name+`", "categories": ["letters"]}`)
+	}
+	done := createTask(t, server, `{"name": "f"}`)
+	expectStatus(t, send(t, server, "PATCH", "/tasks/"+done.ID, `{"complete": true}`), http.StatusOK)
+
+	tasks := decodeTasks(t, send(t, server, "GET", "/tasks?complete=true", ""))
+	if names := taskNames(tasks); names != "f" {
+		t.Errorf("Expected only the complete task, got %v", names)
+	}
+
+	var names []string
+	path := "/tasks?category=letters&sort=name&limit=2"
+	for pages := 0; path != ""; pages++ {
+		if pages == 3 {
+			t.Fatal("Expected 3 pages")
+		}
+
+		response := send(t, server, "GET", path, "")
+		expectStatus(t, response, http.StatusOK)
+
+		names = append(names, taskNames(decodeTasks(t, response)))
+
+		path = ""
+		if cursor := response.header.Get("X-Next-Cursor"); cursor != "" {
+			if !strings.Contains(response.header.Get("Link"), `rel="next"`) {
+				t.Errorf("Expected a Link to the next page, got '%v'", response.header.Get("Link"))
+			}
+			path = "/tasks?category=letters&sort=name&limit=2&cursor=" + cursor
+		}
+	}
+
+	if got := strings.Join(names, "|"); got != "a,b|c,d|e" {
+		t.Errorf("Expected pages a,b|c,d|e, got %v", got)
+	}
+
+	// The same default order is used with or without query parameters.
+	unsorted := taskNames(decodeTasks(t, send(t, server, "GET", "/tasks", "")))
+	if got := taskNames(decodeTasks(t, send(t, server, "GET", "/tasks?limit=10", ""))); got != unsorted {
+		t.Errorf("Expected %v in the same order with a limit, got %v", unsorted, got)
+	}
+	if got := taskNames(decodeTasks(t, send(t, server, "GET", "/tasks?sort=createdDate", ""))); got != unsorted {
+		t.Errorf("Expected %v to be in creation date order, got %v", unsorted, got)
+	}
+
+	response := send(t, server, "GET", "/tasks?sort=name&limit=2", "")
+	cursor := response.header.Get("X-Next-Cursor")
+
+	response = send(t, server, "GET", "/tasks?sort=-name&cursor="+cursor, "")
+	if errorResponse := expectError(t, response, http.StatusBadRequest, CodeValidationFailed); errorResponse.Field != "cursor" {
+		t.Errorf("A cursor can't be used with a different sort, expected it to be blamed, got '%v'", errorResponse.Field)
+	}
+
+	response = send(t, server, "GET", "/tasks?limit=x&sort=colour&bogus=1", "")
+	if errorResponse := expectError(t, response, http.StatusBadRequest, CodeValidationFailed); len(errorResponse.Violations) != 3 {
+		t.Errorf("Expected violations for limit, sort and bogus, got %+v", errorResponse.Violations)
+	}
+}
+
+func TestTaskViews(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	first := createTask(t, server, `{"name": "first"}`)
+	second := createTask(t, server, `{"name": "second"}`)
+	shared := createTask(t, server, `{"name": "shared", "parentIDs": ["`+first.ID+`", "`+second.ID+`"]}`)
+	deep := createTask(t, server, `{"name": "deep", "parentIDs": ["`+shared.ID+`"]}`)
+
+	// Nested, the shared task appears under both its parents, but flat it's
+	// listed just once.
+	tasks := decodeTasks(t, send(t, server, "GET", "/tasks?flat=true&sort=name", ""))
+	if names := taskNames(tasks); names != "deep,first,second,shared" {
+		t.Errorf("Expected every task listed once, got %v", names)
+	}
+	for _, listed := range tasks {
+		if listed.Name == "shared" && !reflect.DeepEqual(listed.ParentIDs, []string{first.ID, second.ID}) {
+			t.Errorf("Expected the shared task to list both parents, got %v", listed.ParentIDs)
+		}
+		if len(listed.Subtasks) != 0 {
+			t.Errorf("Flat tasks shouldn't nest subtasks, %v has %v", listed.Name, listed.Subtasks)
+		}
+	}
+
+	tasks = decodeTasks(t, send(t, server, "GET", "/tasks/"+first.ID+"?flat=true", ""))
+	if names := taskNames(tasks); names != "first,shared,deep" {
+		t.Errorf("Expected the task followed by everything below it, got %v", names)
+	}
+
+	// Past the depth limit subtasks are listed by ID only.
+	got := decodeTask(t, send(t, server, "GET", "/tasks/"+first.ID+"?depth=1", ""))
+	if len(got.Subtasks) != 1 || got.Subtasks[0].ID != shared.ID {
+		t.Fatalf("Expected the shared task nested one level down, got %+v", got.Subtasks)
+	}
+	if nested := got.Subtasks[0]; nested.Subtasks != nil || !reflect.DeepEqual(nested.SubtaskIDs, []string{deep.ID}) {
+		t.Errorf("Expected the shared task's subtasks listed by ID only, got %v nested and IDs %v", nested.Subtasks, nested.SubtaskIDs)
+	}
+
+	got = decodeTask(t, send(t, server, "GET", "/tasks/"+first.ID+"?depth=0", ""))
+	if got.Subtasks != nil || !reflect.DeepEqual(got.SubtaskIDs, []string{shared.ID}) {
+		t.Errorf("Expected no nesting at depth 0, just subtask IDs, got %v nested and IDs %v", got.Subtasks, got.SubtaskIDs)
+	}
+
+	for _, query := range []string{"depth=-1", "depth=x", "flat=maybe", "flat=true&depth=1"} {
+		for _, path := range []string{"/tasks?", "/tasks/" + first.ID + "?"} {
+			response := send(t, server, "GET", path+query, "")
+			errorResponse := expectError(t, response, http.StatusBadRequest, CodeValidationFailed)
+			if len(errorResponse.Violations) != 1 || errorResponse.Field == "" {
+				t.Errorf("Expected a single violation for %v%v, got %+v", path, query, errorResponse)
+			}
+		}
+	}
+}
+
+func TestDeletingLastSubtaskRecursParent(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	chore := createTask(t, server, `{"name": "chore", "recurrence": "FREQ=DAILY"}`)
+	step := createTask(t, server, `{"name": "step", "parentIDs": ["`+chore.ID+`"]}`)
+
+	expectStatus(t, send(t, server, "DELETE", "/tasks/"+step.ID, ""), http.StatusOK)
+
+	tasks := decodeTasks(t, send(t, server, "GET", "/tasks?complete=false", ""))
+	if len(tasks) != 1 || tasks[0].Name != "chore" || tasks[0].ID == chore.ID {
+		t.Errorf("Expected the chore's next occurrence once its last step was deleted, got %+v", tasks)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	created := createTask(t, server, `{"name": "task"}`)
+	path := "/tasks/" + created.ID + "/timer/"
+
+	var started task.TimeEntry
+	response := send(t, server, "POST", path+"start", "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &started)
+	if started.Start == 0 || started.End != 0 {
+		t.Errorf("Expected a running time entry, got %+v", started)
+	}
+
+	expectError(t, send(t, server, "POST", path+"start", ""), http.StatusConflict, CodeTimerRunning)
+
+	var stopped task.TimeEntry
+	response = send(t, server, "POST", path+"stop", "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &stopped)
+	if stopped.Start != started.Start || stopped.End < stopped.Start {
+		t.Errorf("Expected the started entry to be finished, got %+v", stopped)
+	}
+
+	expectError(t, send(t, server, "POST", path+"stop", ""), http.StatusConflict, CodeTimerNotRunning)
+	expectError(t, send(t, server, "POST", "/tasks/missing/timer/start", ""), http.StatusNotFound, CodeTaskNotFound)
+	expectError(t, send(t, server, "GET", path+"start", ""), http.StatusMethodNotAllowed, CodeMethodNotAllowed)
+}
+
+func TestScheduleEndpoint(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	project := createTask(t, server, `{"name": "project"}`)
+	first := createTask(t, server, `{"name": "first", "estimate": 3600, "parentIDs": ["`+project.ID+`"]}`)
+	second := createTask(t, server, `{"name": "second", "estimate": 7200, "parentIDs": ["`+project.ID+`"]}`)
+	expectStatus(t, send(t, server, "POST", "/tasks/"+second.ID+"/dependencies", `{"blockerID": "`+first.ID+`"}`), http.StatusOK)
+
+	var scheduled ScheduleResponse
+	response := send(t, server, "GET", "/tasks/"+project.ID+"/schedule?start=1000", "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &scheduled)
+
+	if scheduled.StartDate != 1000 || scheduled.Duration != 10800 || scheduled.FinishDate != 11800 {
+		t.Errorf("Expected 3 hours of work from 1000, got %+v", scheduled)
+	}
+	if !reflect.DeepEqual(scheduled.CriticalPath, []string{first.ID, second.ID, project.ID}) {
+		t.Errorf("Expected first, second and then the project on the critical path, got %v", scheduled.CriticalPath)
+	}
+
+	for _, start := range []string{"x", "-1"} {
+		response := send(t, server, "GET", "/tasks/"+project.ID+"/schedule?start="+start, "")
+		errorResponse := expectError(t, response, http.StatusBadRequest, CodeValidationFailed)
+		if errorResponse.Field != "start" {
+			t.Errorf("Expected start=%v to be refused, got %+v", start, errorResponse)
+		}
+	}
+
+	expectError(t, send(t, server, "GET", "/tasks/missing/schedule", ""), http.StatusNotFound, CodeTaskNotFound)
+}
+
+func TestQuerySearch(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	parent := createTask(t, server, `{"name": "groceries", "categories": ["home"]}`)
+	createTask(t, server, `{"name": "milk", "parentIDs": ["`+parent.ID+`"]}`)
+	createTask(t, server, `{"name": "report", "categories": ["work"]}`)
+
+	var matches []struct {
+		Task  testTask     `json:"task"`
+		Paths [][]PathStep `json:"paths"`
+	}
+	response := send(t, server, "GET", "/tasks/search?q="+url.QueryEscape(`ancestor:groceries AND NOT complete`), "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &matches)
+
+	if len(matches) != 1 || matches[0].Task.Name != "milk" {
+		t.Fatalf("Expected just the milk, got %+v", matches)
+	}
+	if paths := matches[0].Paths; len(paths) != 1 || len(paths[0]) != 1 || paths[0][0].ID != parent.ID {
+		t.Errorf("Expected the path down from groceries, got %+v", paths)
+	}
+
+	response = send(t, server, "GET", "/tasks/search?q="+url.QueryEscape(`(category:work`), "")
+	expectError(t, response, http.StatusBadRequest, CodeInvalidQuery)
+}
+
+func TestTextSearch(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	createTask(t, server, `{"name": "buy milk", "notes": "the oat kind"}`)
+	createTask(t, server, `{"name": "buy bread"}`)
+	createTask(t, server, `{"name": "write report"}`)
+
+	var matches []struct {
+		Score float64  `json:"score"`
+		Task  testTask `json:"task"`
+	}
+	response := send(t, server, "GET", "/search?q=buy", "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &matches)
+	if len(matches) != 2 {
+		t.Errorf("Expected both purchases, got %+v", matches)
+	}
+
+	response = send(t, server, "GET", "/search?q=buy+oat", "")
+	decodeResponse(t, response, &matches)
+	if len(matches) != 1 || matches[0].Task.Name != "buy milk" || matches[0].Score <= 0 {
+		t.Errorf("Expected words in the notes to match too, got %+v", matches)
+	}
+
+	response = send(t, server, "GET", "/search?q=buy&limit=1", "")
+	decodeResponse(t, response, &matches)
+	if len(matches) != 1 {
+		t.Errorf("Expected the limit to be kept to, got %+v", matches)
+	}
+
+	expectError(t, send(t, server, "GET", "/search", ""), http.StatusBadRequest, CodeInvalidQuery)
+}
+
+func TestNextTasks(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	createTask(t, server, `{"name": "later", "priority": 1}`)
+	urgent := createTask(t, server, `{"name": "urgent", "priority": 3}`)
+	blocker := createTask(t, server, `{"name": "blocker", "priority": 2}`)
+	blocked := createTask(t, server, `{"name": "blocked", "priority": 3}`)
+	expectStatus(t, send(t, server, "POST", "/tasks/"+blocked.ID+"/dependencies", `{"blockerID": "`+blocker.ID+`"}`), http.StatusOK)
+
+	tasks := decodeTasks(t, send(t, server, "GET", "/tasks/next", ""))
+	if names := taskNames(tasks); strings.Contains(names, "blocked") || !strings.HasPrefix(names, "urgent") {
+		t.Errorf("Expected the most pressing unblocked task first and no blocked ones, got %v", names)
+	}
+
+	tasks = decodeTasks(t, send(t, server, "GET", "/tasks/next?limit=1&flat=true", ""))
+	if len(tasks) != 1 || tasks[0].ID != urgent.ID {
+		t.Errorf("Expected just the urgent task, got %+v", tasks)
+	}
+
+	expectError(t, send(t, server, "GET", "/tasks/next?depth=-1", ""), http.StatusBadRequest, CodeValidationFailed)
+}
+
+func TestTaskHistory(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	created := createTask(t, server, `{"name": "task"}`)
+	expectStatus(t, send(t, server, "PATCH", "/tasks/"+created.ID, `{"name": "renamed"}`), http.StatusOK)
+
+	var events []storage.AuditEvent
+	response := send(t, server, "GET", "/tasks/"+created.ID+"/history", "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &events)
+
+	if len(events) != 2 || events[0].Action != storage.AuditActionCreate || events[1].Action != storage.AuditActionUpdate {
+		t.Errorf("Expected the task's creation and its rename, got %+v", events)
+	}
+
+	expectError(t, send(t, server, "GET", "/tasks/missing/history", ""), http.StatusNotFound, CodeHistoryNotFound)
+}
+
+func TestUndoRedo(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	expectError(t, send(t, server, "POST", "/undo", ""), http.StatusConflict, CodeNothingToUndo)
+
+	created := createTask(t, server, `{"name": "task"}`)
+	expectStatus(t, send(t, server, "PATCH", "/tasks/"+created.ID, `{"name": "renamed"}`), http.StatusOK)
+
+	var revision storage.Revision
+	response := send(t, server, "POST", "/undo", "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &revision)
+	if !reflect.DeepEqual(revision.TaskIDs, []string{created.ID}) {
+		t.Errorf("Expected the rename to be undone, got %+v", revision)
+	}
+	if got := getTestTask(t, server, created.ID); got.Name != "task" {
+		t.Errorf("Expected the old name back, got %v", got.Name)
+	}
+
+	expectStatus(t, send(t, server, "POST", "/redo", ""), http.StatusOK)
+	if got := getTestTask(t, server, created.ID); got.Name != "renamed" {
+		t.Errorf("Expected the rename to be made again, got %v", got.Name)
+	}
+
+	expectError(t, send(t, server, "POST", "/redo", ""), http.StatusConflict, CodeNothingToRedo)
+	expectError(t, send(t, server, "GET", "/undo", ""), http.StatusMethodNotAllowed, CodeMethodNotAllowed)
+}
+
+func TestSnapshotsAndRestore(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	created := createTask(t, server, `{"name": "task"}`)
+
+	var taken storage.SnapshotInfo
+	response := send(t, server, "POST", "/admin/snapshots", "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &taken)
+	if taken.ID == "" || taken.TaskCount != 1 {
+		t.Fatalf("Expected a snapshot of the one task, got %+v", taken)
+	}
+
+	expectStatus(t, send(t, server, "DELETE", "/tasks/"+created.ID, ""), http.StatusOK)
+
+	var snapshots []storage.SnapshotInfo
+	response = send(t, server, "GET", "/admin/snapshots", "")
+	expectStatus(t, response, http.StatusOK)
+	decodeResponse(t, response, &snapshots)
+	if len(snapshots) < 2 {
+		t.Errorf("Expected the snapshot taken and the one before the delete, got %+v", snapshots)
+	}
+
+	expectStatus(t, send(t, server, "POST", "/admin/restore", `{"snapshot": "`+taken.ID+`"}`), http.StatusOK)
+	if got := getTestTask(t, server, created.ID); got.Name != "task" {
+		t.Errorf("Expected the deleted task back, got %+v", got)
+	}
+
+	expectError(t, send(t, server, "POST", "/admin/restore", `{}`), http.StatusBadRequest, CodeInvalidField)
+	expectError(t, send(t, server, "POST", "/admin/restore", `{"snapshot": "missing"}`), http.StatusNotFound, CodeSnapshotNotFound)
+	expectError(t, send(t, server, "POST", "/admin/restore", `{"time": 1}`), http.StatusNotFound, CodeSnapshotNotFound)
+}
+
+/*
+Every endpoint listing tasks checks limit the same way, and refuses query
+parameters it doesn't know.
+*/
+func TestListParams(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	createTask(t, server, `{"name": "task"}`)
+
+	for _, path := range []string{"/tasks?", "/tasks/next?", "/search?q=task&"} {
+		for _, limit := range []string{"0", "x", "1001"} {
+			response := send(t, server, "GET", path+"limit="+limit, "")
+			errorResponse := expectError(t, response, http.StatusBadRequest, CodeValidationFailed)
+			if errorResponse.Field != "limit" || len(errorResponse.Violations) != 1 {
+				t.Errorf("Expected limit=%v to be refused by %v, got %+v", limit, path, errorResponse)
+			}
+		}
+
+		expectStatus(t, send(t, server, "GET", path+"limit=1", ""), http.StatusOK)
+	}
+
+	for _, path := range []string{"/tasks?", "/tasks/next?", "/search?q=task&", "/tasks/search?q=task&"} {
+		response := send(t, server, "GET", path+"bogus=1", "")
+		errorResponse := expectError(t, response, http.StatusBadRequest, CodeValidationFailed)
+		if errorResponse.Field != "bogus" || len(errorResponse.Violations) != 1 {
+			t.Errorf("Expected bogus to be refused by %v, got %+v", path, errorResponse)
+		}
+	}
+
+	// /tasks/search lists every match, so it takes no limit either.
+	response := send(t, server, "GET", "/tasks/search?q=task&limit=1", "")
+	if errorResponse := expectError(t, response, http.StatusBadRequest, CodeValidationFailed); errorResponse.Field != "limit" {
+		t.Errorf("Expected limit to be refused by /tasks/search, got %+v", errorResponse)
+	}
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// TaskHistory handles requests to the /tasks/{id}/history endpoint.
+func TaskHistory(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "GET":
+		handler = getTaskHistory
+	}
+
+	handler(response, request)
+}
+
+func getTaskHistory(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+
+	events, err := store.History(taskID)
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	if len(events) == 0 {
+		writeError(newRequestError(http.StatusNotFound, CodeHistoryNotFound, "", "No history recorded for task '%v'", taskID), response, request)
+		return
+	}
+
+	WriteJSONResponse(response, events, http.StatusOK)
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+MoveTaskParams is the json struct that gets passed in the request to move a
+task from one parent to another. Leaving From empty moves a root task under
+a parent, leaving To empty moves the task out to the root tasks. A move
+which would complete a blocked parent is refused unless the request's
+query string has force=true.
+*/
+type MoveTaskParams struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// MoveTask handles requests to the /tasks/{id}/move endpoint.
+func MoveTask(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "POST":
+		handler = postMoveTask
+	}
+
+	handler(response, request)
+}
+
+func postMoveTask(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	var params MoveTaskParams
+	if err := decodeBody(request, &params); err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	if params.From == "" && params.To == "" {
+		writeError(newRequestError(http.StatusBadRequest, CodeInvalidField, "to", "A move needs a task to move from or to"), response, request)
+		return
+	}
+
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+
+	err := store.Update(getMutation(request, taskID), func(tasklist *task.Tasklist) error {
+		moving, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		if ifMatchFails(request, taskETag(moving.Revision)) {
+			return errPreconditionFailed
+		}
+
+		var from, to *task.Task
+		var ok bool
+
+		if params.From != "" {
+			from, ok = tasklist.Registry[params.From]
+			if !ok {
+				return fieldTaskNotFound("from", params.From)
+			}
+
+			if !moving.HasParent(from.ID) {
+				return newRequestError(http.StatusConflict, CodeNotAParent, "from", "Task '%v' isn't a subtask of task '%v'", taskID, params.From)
+			}
+		} else if !moving.IsRootTask() {
+			return newRequestError(http.StatusConflict, CodeNotAParent, "from", "Task '%v' isn't a root task, say which parent to move it from", taskID)
+		}
+
+		if params.To != "" {
+			to, ok = tasklist.Registry[params.To]
+			if !ok {
+				return fieldTaskNotFound("to", params.To)
+			}
+		}
+
+		// Moving a task away can complete its old parent, which may be
+		// blocked.
+		return tasklist.Recur(func() error {
+			return tasklist.GuardBlocked(isForced(request), func() error {
+				return tasklist.Move(moving, from, to)
+			})
+		})
+	})
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteBasicResponse(http.StatusOK, response)
+}
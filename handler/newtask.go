@@ -1,12 +1,9 @@
 package handler
 
 import (
-	"encoding/json"
 	"net/http"
+	"time"
 
-	"github.com/jeffbmartinez/log"
-
-	"github.com/jeffbmartinez/todo-persistence/storage"
 	"github.com/jeffbmartinez/todo-persistence/task"
 )
 
@@ -16,14 +13,26 @@ a new Task object.
 */
 type NewTaskParams struct {
 	Name       string   `json:"name"`
+	Notes      string   `json:"notes"`
+	Priority   int      `json:"priority"`
+	Recurrence string   `json:"recurrence"`
 	ParentIDs  []string `json:"parentIDs"`
 	DueDate    int64    `json:"dueDate"`
+	Estimate   int64    `json:"estimate"`
 	Categories []string `json:"categories"`
 }
 
+/*
+Validate normalizes the params and checks them against the task package's
+validation rules.
+*/
+func (p *NewTaskParams) Validate() []task.Violation {
+	return validateFields(&p.Name, p.Notes, p.Priority, &p.Recurrence, p.DueDate, p.Estimate, &p.Categories)
+}
+
 // NewTask handles requests to the /tasks/new endpoint.
 func NewTask(response http.ResponseWriter, request *http.Request) {
-	handler := BasicResponse(http.StatusMethodNotAllowed)
+	handler := methodNotAllowed
 
 	switch request.Method {
 	case "POST":
@@ -34,51 +43,38 @@ func NewTask(response http.ResponseWriter, request *http.Request) {
 }
 
 func postNewTask(response http.ResponseWriter, request *http.Request) {
-	if request.Body == nil {
-		log.Warn("Empty body in new task POST request")
-		WriteBasicResponse(http.StatusBadRequest, response)
+	store, ok := getStore(response, request)
+	if !ok {
 		return
 	}
 
-	defer request.Body.Close()
-	decoder := json.NewDecoder(request.Body)
-
 	var params NewTaskParams
-	err := decoder.Decode(&params)
-	if err != nil {
-		log.Warn("Couldn't decode params")
-		WriteBasicResponse(http.StatusBadRequest, response)
+	if err := decodeBody(request, &params); err != nil {
+		writeError(err, response, request)
 		return
 	}
 
-	tasklist, err := storage.GetTasklist()
-	if err != nil {
-		log.Errorf("Could not get tasklist")
-		WriteBasicResponse(http.StatusInternalServerError, response)
-		return
-	}
-
-	var parentTasks []*task.Task
-	for _, parentID := range params.ParentIDs {
-		parentTask, ok := tasklist.Registry[parentID]
-		if !ok {
-			log.Warnf("Couldn't find parent task (%v)", parentID)
-			WriteBasicResponse(http.StatusBadRequest, response)
-			return
+	var newTask *task.Task
+	err := store.Update(getMutation(request, ""), func(tasklist *task.Tasklist) error {
+		var err error
+		newTask, err = tasklist.CreateTask(params.Name, params.ParentIDs)
+		if err != nil {
+			return err
 		}
 
-		parentTasks = append(parentTasks, parentTask)
-	}
-
-	newTask := tasklist.AddTask(params.Name, parentTasks)
-	newTask.DueDate = params.DueDate
-	newTask.Categories = params.Categories
+		newTask.Notes = params.Notes
+		newTask.Priority = params.Priority
+		newTask.Recurrence = params.Recurrence
+		newTask.DueDate = params.DueDate
+		newTask.Estimate = params.Estimate
+		newTask.Categories = params.Categories
 
-	if err := storage.SaveTasklist(tasklist); err != nil {
-		log.Errorf("Couldn't save tasklist (%v)", err)
-		WriteBasicResponse(http.StatusInternalServerError, response)
+		return nil
+	})
+	if err != nil {
+		writeError(err, response, request)
 		return
 	}
 
-	WriteJSONResponse(response, newTask, http.StatusOK)
+	WriteJSONResponse(response, newTreeTask(newTask, -1, task.NewRollUps(time.Now())), http.StatusOK)
 }
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+const defaultNextActionsLimit = 10
+
+/*
+nextParams lists the query parameters a GET /tasks/next request understands.
+*/
+var nextParams = map[string]bool{
+	"limit": true,
+	"flat":  true,
+	"depth": true,
+}
+
+// NextTasks handles requests to the /tasks/next endpoint.
+func NextTasks(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "GET":
+		handler = getNextTasks
+	}
+
+	handler(response, request)
+}
+
+/*
+getNextTasks lists the tasks to work on next, most pressing first (see
+Tasklist.NextActions). At most limit tasks (10 unless given) are listed,
+laid out as the flat and depth query parameters ask.
+*/
+func getNextTasks(response http.ResponseWriter, request *http.Request) {
+	values := request.URL.Query()
+
+	limit, violations := getListParams(values, nextParams, defaultNextActionsLimit)
+
+	view, viewViolations := getTaskView(values)
+	violations = append(violations, viewViolations...)
+
+	if len(violations) > 0 {
+		writeError(invalidQuery(violations), response, request)
+		return
+	}
+
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	store.View(func(tasklist *task.Tasklist) error {
+		actions := tasklist.NextActions()
+		if len(actions) > limit {
+			actions = actions[:limit]
+		}
+
+		WriteJSONResponse(response, view.render(actions), http.StatusOK)
+
+		return nil
+	})
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+const requestIDHeader = "X-Request-ID"
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+/*
+RequestIDMiddleware gives every request an ID, so error responses can be
+matched up with the server's logs. A client can choose the ID by sending
+an X-Request-ID header, otherwise one is made up. Either way it's sent back
+in the X-Request-ID response header.
+*/
+type RequestIDMiddleware struct{}
+
+func (m RequestIDMiddleware) ServeHTTP(response http.ResponseWriter, request *http.Request, next http.HandlerFunc) {
+	requestID := request.Header.Get(requestIDHeader)
+	if !isValidRequestID(requestID) {
+		requestID = newRequestID()
+	}
+
+	response.Header().Set(requestIDHeader, requestID)
+
+	next(response, request.WithContext(context.WithValue(request.Context(), requestIDKey{}, requestID)))
+}
+
+/*
+getRequestID returns the ID given to a request. A request which didn't go
+through RequestIDMiddleware is given an ID on the spot.
+*/
+func getRequestID(response http.ResponseWriter, request *http.Request) string {
+	if requestID, ok := request.Context().Value(requestIDKey{}).(string); ok {
+		return requestID
+	}
+
+	requestID := response.Header().Get(requestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+		response.Header().Set(requestIDHeader, requestID)
+	}
+
+	return requestID
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+/*
+isValidRequestID returns true for IDs which are safe to log and send back,
+printable ascii of a reasonable length.
+*/
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
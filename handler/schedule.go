@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/jeffbmartinez/todo-persistence/schedule"
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+ScheduledTask is where a task falls in a schedule. Times are in seconds from
+the start of the schedule, see schedule.Entry. External tasks are outside
+the scheduled task, but hold up work inside it.
+*/
+type ScheduledTask struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Complete bool   `json:"complete"`
+	External bool   `json:"external"`
+	Duration int64  `json:"duration"`
+
+	EarliestStart  int64 `json:"earliestStart"`
+	EarliestFinish int64 `json:"earliestFinish"`
+	LatestStart    int64 `json:"latestStart"`
+	LatestFinish   int64 `json:"latestFinish"`
+	Slack          int64 `json:"slack"`
+	Critical       bool  `json:"critical"`
+}
+
+/*
+ScheduleResponse is the schedule of a task and everything below it, along
+with any incomplete tasks outside it they wait on. Tasks are listed in
+topological order, and CriticalPath lists the IDs of the tasks which
+decide how long the work takes, first to last. StartDate and FinishDate
+are unix timestamps, the finish being the earliest the task can be done if
+work starts at StartDate.
+*/
+type ScheduleResponse struct {
+	TaskID       string          `json:"taskID"`
+	StartDate    int64           `json:"startDate"`
+	FinishDate   int64           `json:"finishDate"`
+	Duration     int64           `json:"duration"`
+	CriticalPath []string        `json:"criticalPath"`
+	Tasks        []ScheduledTask `json:"tasks"`
+}
+
+// TaskSchedule handles requests to the /tasks/{id}/schedule endpoint.
+func TaskSchedule(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "GET":
+		handler = getSchedule
+	}
+
+	handler(response, request)
+}
+
+/*
+getSchedule works out the critical path schedule of the task and everything
+below it. Work starts now, or at the unix timestamp in the start query
+parameter.
+*/
+func getSchedule(response http.ResponseWriter, request *http.Request) {
+	start := time.Now().Unix()
+	if value := request.URL.Query().Get("start"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 0 || parsed > task.MaxDueDate {
+			violations := []task.Violation{{Field: "start", Message: fmt.Sprintf("start must be a unix timestamp in seconds, from 0 to %v", int64(task.MaxDueDate))}}
+			writeError(invalidQuery(violations), response, request)
+			return
+		}
+		start = parsed
+	}
+
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+
+	err := store.View(func(tasklist *task.Tasklist) error {
+		t, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		s, err := schedule.New(*tasklist, t)
+		if err != nil {
+			return err
+		}
+
+		WriteJSONResponse(response, newScheduleResponse(s, start), http.StatusOK)
+
+		return nil
+	})
+	if err != nil {
+		writeError(err, response, request)
+	}
+}
+
+func newScheduleResponse(s *schedule.Schedule, start int64) ScheduleResponse {
+	criticalPath := make([]string, 0, len(s.CriticalPath))
+	for _, entry := range s.CriticalPath {
+		criticalPath = append(criticalPath, entry.Task.ID)
+	}
+
+	tasks := make([]ScheduledTask, 0, len(s.Order))
+	for _, entry := range s.Order {
+		tasks = append(tasks, ScheduledTask{
+			ID:             entry.Task.ID,
+			Name:           entry.Task.Name,
+			Complete:       entry.Task.Complete,
+			External:       entry.External,
+			Duration:       entry.Duration,
+			EarliestStart:  entry.EarliestStart,
+			EarliestFinish: entry.EarliestFinish,
+			LatestStart:    entry.LatestStart,
+			LatestFinish:   entry.LatestFinish,
+			Slack:          entry.Slack,
+			Critical:       entry.Critical,
+		})
+	}
+
+	return ScheduleResponse{
+		TaskID:       s.Root.ID,
+		StartDate:    start,
+		FinishDate:   start + s.Duration,
+		Duration:     s.Duration,
+		CriticalPath: criticalPath,
+		Tasks:        tasks,
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jeffbmartinez/todo-persistence/query"
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+SearchMatch is a task found by a search, listed on its own rather than with
+its subtasks, along with every path leading down to it from a root task.
+*/
+type SearchMatch struct {
+	Task  FlatTask     `json:"task"`
+	Paths [][]PathStep `json:"paths"`
+}
+
+/*
+PathStep is one of the tasks along the path down to a search match.
+*/
+type PathStep struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+/*
+searchParams lists the query parameters a GET /tasks/search request
+understands.
+*/
+var searchParams = map[string]bool{
+	"q": true,
+}
+
+// SearchTasks handles requests to the /tasks/search endpoint.
+func SearchTasks(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "GET":
+		handler = searchTasks
+	}
+
+	handler(response, request)
+}
+
+/*
+searchTasks runs the query in the q parameter (see the query package for
+the language) and lists every matching task, oldest first.
+*/
+func searchTasks(response http.ResponseWriter, request *http.Request) {
+	values := request.URL.Query()
+
+	if _, violations := getListParams(values, searchParams, 0); len(violations) > 0 {
+		writeError(invalidQuery(violations), response, request)
+		return
+	}
+
+	q, err := query.Parse(values.Get("q"), time.Now())
+	if err != nil {
+		writeError(newRequestError(http.StatusBadRequest, CodeInvalidQuery, "q", "Invalid query (%v)", err), response, request)
+		return
+	}
+
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	store.View(func(tasklist *task.Tasklist) error {
+		rollUps := task.NewRollUps(time.Now())
+		matches := []SearchMatch{}
+		for _, t := range query.Search(tasklist, q) {
+			matches = append(matches, SearchMatch{
+				Task:  newFlatTask(t, rollUps),
+				Paths: getPathSteps(query.Paths(t)),
+			})
+		}
+
+		WriteJSONResponse(response, matches, http.StatusOK)
+
+		return nil
+	})
+}
+
+func getPathSteps(paths [][]*task.Task) [][]PathStep {
+	steps := make([][]PathStep, 0, len(paths))
+	for _, path := range paths {
+		pathSteps := make([]PathStep, 0, len(path))
+		for _, t := range path {
+			pathSteps = append(pathSteps, PathStep{ID: t.ID, Name: t.Name})
+		}
+		steps = append(steps, pathSteps)
+	}
+
+	return steps
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+)
+
+/*
+RestoreParams is the json struct that gets passed in the request to restore
+a tasklist. Either the ID of the snapshot to restore, or a time (unix
+timestamp) to restore the tasklist as of, must be supplied.
+*/
+type RestoreParams struct {
+	SnapshotID string `json:"snapshot"`
+	Time       int64  `json:"time"`
+}
+
+// Snapshots handles requests to the /admin/snapshots endpoint.
+func Snapshots(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "GET":
+		handler = getSnapshots
+	case "POST":
+		handler = postSnapshot
+	}
+
+	handler(response, request)
+}
+
+// Restore handles requests to the /admin/restore endpoint.
+func Restore(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "POST":
+		handler = postRestore
+	}
+
+	handler(response, request)
+}
+
+func getSnapshots(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	snapshots, err := store.Snapshots()
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteJSONResponse(response, snapshots, http.StatusOK)
+}
+
+func postSnapshot(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	snapshot, err := store.TakeSnapshot()
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteJSONResponse(response, snapshot, http.StatusOK)
+}
+
+func postRestore(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	var params RestoreParams
+	if err := decodeBody(request, &params); err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	if params.SnapshotID == "" && params.Time == 0 {
+		writeError(newRequestError(http.StatusBadRequest, CodeInvalidField, "snapshot", "Either a snapshot or a time to restore as of is needed"), response, request)
+		return
+	}
+
+	snapshotID := params.SnapshotID
+	if snapshotID == "" {
+		var err error
+		snapshotID, err = store.SnapshotAsOf(time.Unix(params.Time, 0))
+		if err != nil {
+			writeError(err, response, request)
+			return
+		}
+	}
+
+	if err := store.RestoreSnapshot(getMutation(request, ""), snapshotID); err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteBasicResponse(http.StatusOK, response)
+}
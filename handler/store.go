@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/jeffbmartinez/todo-persistence/storage"
+)
+
+var lists *storage.Lists
+
+/*
+UseLists sets the tasklists the handlers read tasks from and write tasks
+to. It must be called before the handlers start serving requests.
+*/
+func UseLists(l *storage.Lists) {
+	lists = l
+}
+
+/*
+getStore returns the store for the list named in the request's path, or the
+default list if the path doesn't name one. If the store can't be had, an
+error response is written and ok is false.
+*/
+func getStore(response http.ResponseWriter, request *http.Request) (store *storage.Store, ok bool) {
+	listName, named := mux.Vars(request)["list"]
+	if !named {
+		listName = storage.DefaultListName
+	}
+
+	store, err := lists.Get(listName)
+	if err != nil {
+		writeError(err, response, request)
+		return nil, false
+	}
+
+	return store, true
+}
+
+/*
+getMutation describes the change a request is making to a list, aimed at
+the task with the supplied ID (if any), for the audit log. Clients identify
+who is making the change with an X-Actor header, without one the change is
+put down to the client's address.
+*/
+func getMutation(request *http.Request, taskID string) storage.Mutation {
+	actor := request.Header.Get("X-Actor")
+	if actor == "" {
+		actor = request.RemoteAddr
+		if host, _, err := net.SplitHostPort(request.RemoteAddr); err == nil {
+			actor = host
+		}
+	}
+
+	return storage.Mutation{
+		Actor:     actor,
+		Operation: request.Method + " " + request.URL.Path,
+		TaskID:    taskID,
+	}
+}
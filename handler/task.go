@@ -2,36 +2,71 @@ package handler
 
 import (
 	"encoding/json"
+	"io/ioutil"
+	"mime"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
-	"github.com/jeffbmartinez/log"
 
-	"github.com/jeffbmartinez/todo-persistence/storage"
+	"github.com/jeffbmartinez/todo-persistence/patch"
+	"github.com/jeffbmartinez/todo-persistence/task"
 )
 
+const mergePatchMediaType = "application/merge-patch+json"
+const jsonPatchMediaType = "application/json-patch+json"
+
 /*
 UpdateTaskParams is the json struct that gets passed in the request to update
-a Task object.
+a Task object. A PUT replaces the task's name, notes, priority, recurrence,
+completion, due date, estimate, categories, subtasks and parents, anything
+left out is cleared. Subtasks and parents taken away from the task are unlinked from
+it rather than deleted, and become root tasks if they have nowhere else to
+go. Dependencies are left alone, they're changed through
+/tasks/{id}/dependencies, and so are time entries, which are logged through
+/tasks/{id}/timer.
+
+A PATCH patches the same fields, either with a JSON Merge Patch (RFC 7396)
+or with a JSON Patch (RFC 6902) when sent as application/json-patch+json.
+Fields the patch leaves out are left as they are, and merge patch nulls
+clear them.
+
+Completing a blocked task is refused unless the request's query string has
+force=true. That goes for tasks the update completes along the way too,
+such as a blocked parent completed along with its last subtask.
 */
 type UpdateTaskParams struct {
 	Name       string   `json:"name"`
+	Notes      string   `json:"notes"`
+	Priority   int      `json:"priority"`
+	Recurrence string   `json:"recurrence"`
 	Complete   bool     `json:"complete"`
 	SubtaskIDs []string `json:"subtaskIDs"`
 	ParentIDs  []string `json:"parentIDs"`
 	DueDate    int64    `json:"dueDate"`
+	Estimate   int64    `json:"estimate"`
 	Categories []string `json:"categories"`
 }
 
+/*
+Validate normalizes the params and checks them against the task package's
+validation rules.
+*/
+func (p *UpdateTaskParams) Validate() []task.Violation {
+	return validateFields(&p.Name, p.Notes, p.Priority, &p.Recurrence, p.DueDate, p.Estimate, &p.Categories)
+}
+
 // Task handles requests to the /tasks/{id} endpoint.
 func Task(response http.ResponseWriter, request *http.Request) {
-	handler := BasicResponse(http.StatusMethodNotAllowed)
+	handler := methodNotAllowed
 
 	switch request.Method {
 	case "GET":
 		handler = getTask
 	case "PUT":
 		handler = putTask
+	case "PATCH":
+		handler = patchTask
 	case "DELETE":
 		handler = deleteTask
 	}
@@ -39,128 +74,298 @@ func Task(response http.ResponseWriter, request *http.Request) {
 	handler(response, request)
 }
 
+/*
+getTask responds with the task and all its subtasks. The flat and depth
+query parameters change how they're laid out, see taskView.
+
+The ETag is the task's own revision, for use with If-Match on later
+updates. The response also carries its subtasks, whether it's blocked and
+its roll-up, none of which change the revision, so If-None-Match isn't
+honored here.
+*/
 func getTask(response http.ResponseWriter, request *http.Request) {
+	view, violations := getTaskView(request.URL.Query())
+	if len(violations) > 0 {
+		writeError(invalidQuery(violations), response, request)
+		return
+	}
+
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(request)
 	taskID := vars["id"]
 
-	tasklist, err := storage.GetTasklist()
+	err := store.View(func(tasklist *task.Tasklist) error {
+		task, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		response.Header().Set("ETag", taskETag(task.Revision))
+
+		WriteJSONResponse(response, view.renderTask(tasklist, task), http.StatusOK)
+
+		return nil
+	})
 	if err != nil {
-		log.Errorf("Couldn't get tasklist (%v)", err)
-		WriteBasicResponse(http.StatusInternalServerError, response)
-		return
+		writeError(err, response, request)
 	}
+}
 
-	task, ok := tasklist.Registry[taskID]
+func putTask(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
 	if !ok {
-		WriteBasicResponse(http.StatusNotFound, response)
 		return
 	}
 
-	WriteJSONResponse(response, task, http.StatusOK)
+	var params UpdateTaskParams
+	if err := decodeBody(request, &params); err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+
+	err := store.Update(getMutation(request, taskID), func(tasklist *task.Tasklist) error {
+		task, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		if ifMatchFails(request, taskETag(task.Revision)) {
+			return errPreconditionFailed
+		}
+
+		return tasklist.Recur(func() error {
+			return tasklist.GuardBlocked(isForced(request), func() error {
+				return updateTask(tasklist, task, params)
+			})
+		})
+	})
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteBasicResponse(http.StatusOK, response)
 }
 
-func putTask(response http.ResponseWriter, request *http.Request) {
+func patchTask(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
 	if request.Body == nil {
-		WriteBasicResponse(http.StatusBadRequest, response)
+		writeError(errMissingBody, response, request)
 		return
 	}
 
-	defer request.Body.Close()
-	decoder := json.NewDecoder(request.Body)
+	applyPatch := patch.Merge
 
-	var params UpdateTaskParams
-	err := decoder.Decode(&params)
+	contentType := request.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "", "application/json", mergePatchMediaType:
+	case jsonPatchMediaType:
+		applyPatch = patch.Apply
+	default:
+		writeError(newRequestError(http.StatusUnsupportedMediaType, CodeUnsupportedMediaType, "", "Patches must be sent as %v or %v, not %v", mergePatchMediaType, jsonPatchMediaType, contentType), response, request)
+		return
+	}
+
+	defer request.Body.Close()
+	body, err := ioutil.ReadAll(request.Body)
 	if err != nil {
-		WriteBasicResponse(http.StatusBadRequest, response)
+		writeError(newRequestError(http.StatusBadRequest, CodeMissingBody, "", "Couldn't read the request body (%v)", err), response, request)
 		return
 	}
 
 	vars := mux.Vars(request)
 	taskID := vars["id"]
 
-	tasklist, err := storage.GetTasklist()
+	err = store.Update(getMutation(request, taskID), func(tasklist *task.Tasklist) error {
+		task, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		if ifMatchFails(request, taskETag(task.Revision)) {
+			return errPreconditionFailed
+		}
+
+		document, err := json.Marshal(getUpdateTaskParams(task))
+		if err != nil {
+			return err
+		}
+
+		patched, err := applyPatch(document, body)
+		if operationErr, ok := err.(*patch.OperationError); ok && operationErr.Err == patch.ErrTestFailed {
+			return newRequestError(http.StatusConflict, CodePatchTestFailed, "", "%v", err)
+		} else if err != nil {
+			return newRequestError(http.StatusBadRequest, CodeInvalidPatch, "", "Couldn't apply the patch (%v)", err)
+		}
+
+		var params UpdateTaskParams
+		if err := decodeJSON(patched, &params); err != nil {
+			return err
+		}
+
+		return tasklist.Recur(func() error {
+			return tasklist.GuardBlocked(isForced(request), func() error {
+				return updateTask(tasklist, task, params)
+			})
+		})
+	})
 	if err != nil {
-		log.Errorf("Couldn't get tasklist (%v)", err)
-		WriteBasicResponse(http.StatusInternalServerError, response)
+		writeError(err, response, request)
 		return
 	}
 
-	task, ok := tasklist.Registry[taskID]
-	if !ok {
-		WriteBasicResponse(http.StatusNotFound, response)
-		return
-	}
+	WriteBasicResponse(http.StatusOK, response)
+}
 
-	// TODO: Modify the task
-	if params.Name != "" {
-		task.Name = params.Name
+/*
+getUpdateTaskParams returns the fields of a task which can be changed, as
+the document a PATCH request patches.
+*/
+func getUpdateTaskParams(t *task.Task) UpdateTaskParams {
+	return UpdateTaskParams{
+		Name:       t.Name,
+		Notes:      t.Notes,
+		Priority:   t.Priority,
+		Recurrence: t.Recurrence,
+		Complete:   t.Complete,
+		DueDate:    t.DueDate,
+		Estimate:   t.Estimate,
+		Categories: t.Categories,
+		SubtaskIDs: getTaskIDs(t.Subtasks),
+		ParentIDs:  getTaskIDs(t.Parents),
 	}
+}
 
-	task.SetComplete(params.Complete)
-	if params.Categories != nil {
-		task.Categories = params.Categories
+func getTaskIDs(tasks []*task.Task) []string {
+	ids := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.ID)
 	}
 
-	if params.DueDate != 0 {
-		task.DueDate = params.DueDate
+	return ids
+}
+
+/*
+isForced returns true if the request has force=true in its query string,
+asking to complete tasks even though they're blocked (see
+Tasklist.GuardBlocked).
+*/
+func isForced(request *http.Request) bool {
+	force, _ := strconv.ParseBool(request.URL.Query().Get("force"))
+	return force
+}
+
+/*
+updateTask replaces the fields of a task, along with its parents and
+subtasks, with the ones in validated params. Linking and unlinking subtasks
+can complete or reopen the task, so its completion is set last, leaving it
+as the params say.
+*/
+func updateTask(tasklist *task.Tasklist, t *task.Task, params UpdateTaskParams) error {
+	t.Name = params.Name
+	t.Notes = params.Notes
+	t.Priority = params.Priority
+	t.Recurrence = params.Recurrence
+	t.DueDate = params.DueDate
+	t.Estimate = params.Estimate
+
+	t.Categories = params.Categories
+	if t.Categories == nil {
+		t.Categories = []string{}
 	}
 
+	subtasks := make(map[string]*task.Task)
 	for _, subtaskID := range params.SubtaskIDs {
 		subtask, ok := tasklist.Registry[subtaskID]
 		if !ok {
-			log.Warnf("Could not find subtask (%v)", subtaskID)
-			WriteBasicResponse(http.StatusBadRequest, response)
-			return
+			return fieldTaskNotFound("subtaskIDs", subtaskID)
 		}
 
-		task.AddSubtask(subtask)
+		subtasks[subtaskID] = subtask
 	}
 
+	parents := make(map[string]*task.Task)
 	for _, parentID := range params.ParentIDs {
 		parent, ok := tasklist.Registry[parentID]
 		if !ok {
-			log.Warnf("Could not find parent task (%v)", parentID)
-			WriteBasicResponse(http.StatusBadRequest, response)
-			return
+			return fieldTaskNotFound("parentIDs", parentID)
 		}
 
-		task.AddParent(parent)
+		parents[parentID] = parent
 	}
 
-	err = storage.SaveTasklist(tasklist)
-
-	if err != nil {
-		log.Errorf("Couldn't save tasklist (%v)", err)
-		WriteBasicResponse(http.StatusInternalServerError, response)
-		return
+	// Unlinking changes the slices being looped over, so work from copies.
+	for _, subtask := range append([]*task.Task(nil), t.Subtasks...) {
+		if _, keep := subtasks[subtask.ID]; !keep {
+			tasklist.Unlink(t, subtask)
+		}
 	}
 
-	WriteBasicResponse(http.StatusOK, response)
-}
+	for _, parent := range append([]*task.Task(nil), t.Parents...) {
+		if _, keep := parents[parent.ID]; !keep {
+			tasklist.Unlink(parent, t)
+		}
+	}
 
-func deleteTask(response http.ResponseWriter, request *http.Request) {
-	vars := mux.Vars(request)
-	taskID := vars["id"]
+	for _, subtaskID := range params.SubtaskIDs {
+		if err := tasklist.Link(t, subtasks[subtaskID]); err != nil {
+			return err
+		}
+	}
 
-	tasklist, err := storage.GetTasklist()
-	if err != nil {
-		log.Errorf("Couldn't get tasklist (%v)", err)
-		WriteBasicResponse(http.StatusInternalServerError, response)
-		return
+	for _, parentID := range params.ParentIDs {
+		if err := tasklist.Link(parents[parentID], t); err != nil {
+			return err
+		}
 	}
 
-	task, ok := tasklist.Registry[taskID]
+	t.SetComplete(params.Complete)
+
+	return nil
+}
+
+func deleteTask(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
 	if !ok {
-		WriteBasicResponse(http.StatusNotFound, response)
 		return
 	}
 
-	tasklist.Delete(task)
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+
+	err := store.Update(getMutation(request, taskID), func(tasklist *task.Tasklist) error {
+		task, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		if ifMatchFails(request, taskETag(task.Revision)) {
+			return errPreconditionFailed
+		}
 
-	err = storage.SaveTasklist(tasklist)
+		// Deleting a task can complete its parents, which may be blocked
+		// or recur.
+		return tasklist.Recur(func() error {
+			return tasklist.GuardBlocked(isForced(request), func() error {
+				tasklist.Delete(task)
+				return nil
+			})
+		})
+	})
 	if err != nil {
-		log.Errorf("Couldn't save tasklist (%v)", err)
-		WriteBasicResponse(http.StatusInternalServerError, response)
+		writeError(err, response, request)
 		return
 	}
 
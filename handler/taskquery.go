@@ -0,0 +1,283 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+const maxPageSize = 1000
+
+/*
+taskQuery describes which tasks to list, in what order, which page of
+them, and how to lay them out, as given in the query string of a GET /tasks
+request.
+*/
+type taskQuery struct {
+	filter   task.Filter
+	ordering task.Ordering
+	view     taskView
+
+	/*
+		limit is the most tasks to list, 0 for no limit.
+	*/
+	limit int
+
+	/*
+		after is the last task listed on the previous page, if any.
+	*/
+	after *task.Task
+}
+
+/*
+cursor marks the place a page of tasks ended, so the next page can carry on
+from there. It holds the sort keys of the last task listed rather than its
+position, so tasks added or removed in the meantime don't make the next
+page skip or repeat any. It's handed to clients as opaque base64.
+*/
+type cursor struct {
+	Sort         string `json:"sort"`
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	CreatedDate  int64  `json:"createdDate"`
+	ModifiedDate int64  `json:"modifiedDate"`
+	DueDate      int64  `json:"dueDate"`
+	Priority     int    `json:"priority"`
+}
+
+/*
+queryParams lists the query parameters a GET /tasks request understands.
+*/
+var queryParams = map[string]bool{
+	"complete":       true,
+	"category":       true,
+	"name":           true,
+	"dueAfter":       true,
+	"dueBefore":      true,
+	"createdAfter":   true,
+	"createdBefore":  true,
+	"modifiedAfter":  true,
+	"modifiedBefore": true,
+	"sort":           true,
+	"limit":          true,
+	"cursor":         true,
+	"flat":           true,
+	"depth":          true,
+}
+
+/*
+getTaskQuery reads the query string of a request, returning an error
+listing every parameter which is wrong if any are.
+*/
+func getTaskQuery(values url.Values) (taskQuery, error) {
+	query := taskQuery{}
+
+	limit, violations := getListParams(values, queryParams, 0)
+	query.limit = limit
+
+	violate := func(param string, format string, args ...interface{}) {
+		violations = append(violations, task.Violation{
+			Field:   param,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	if complete := values.Get("complete"); complete != "" {
+		value, err := strconv.ParseBool(complete)
+		if err != nil {
+			violate("complete", "complete must be true or false")
+		} else {
+			query.filter.Complete = &value
+		}
+	}
+
+	query.filter.Categories = task.NormalizeCategories(values["category"])
+	query.filter.NameContains = strings.TrimSpace(values.Get("name"))
+
+	dates := []struct {
+		param string
+		value *int64
+	}{
+		{"dueAfter", &query.filter.DueAfter},
+		{"dueBefore", &query.filter.DueBefore},
+		{"createdAfter", &query.filter.CreatedAfter},
+		{"createdBefore", &query.filter.CreatedBefore},
+		{"modifiedAfter", &query.filter.ModifiedAfter},
+		{"modifiedBefore", &query.filter.ModifiedBefore},
+	}
+	for _, date := range dates {
+		if value := values.Get(date.param); value != "" {
+			parsed, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || parsed <= 0 {
+				violate(date.param, "%v must be a positive unix timestamp", date.param)
+			} else {
+				*date.value = parsed
+			}
+		}
+	}
+
+	ordering, err := task.ParseOrdering(values.Get("sort"))
+	if err != nil {
+		violate("sort", "sort must be one of %v, %v, %v, %v or %v, optionally prefixed with - for descending order", task.SortByCreatedDate, task.SortByModifiedDate, task.SortByDueDate, task.SortByPriority, task.SortByName)
+	}
+	query.ordering = ordering
+
+	if encoded := values.Get("cursor"); encoded != "" {
+		after, err := decodeCursor(encoded, query.ordering)
+		if err != nil {
+			violate("cursor", "%v", err)
+		} else {
+			query.after = after
+		}
+	}
+
+	view, viewViolations := getTaskView(values)
+	violations = append(violations, viewViolations...)
+	query.view = view
+
+	if len(violations) > 0 {
+		return taskQuery{}, invalidQuery(violations)
+	}
+
+	return query, nil
+}
+
+/*
+getListParams checks the query parameters every endpoint listing tasks
+shares: that each parameter is one of the known ones, and that limit, if
+known and given, is a number from 1 to maxPageSize. It returns the limit,
+or defaultLimit if none was given, along with the parameters which are
+wrong, for invalidQuery.
+*/
+func getListParams(values url.Values, known map[string]bool, defaultLimit int) (int, []task.Violation) {
+	violations := []task.Violation{}
+
+	unknown := []string{}
+	for param := range values {
+		if !known[param] {
+			unknown = append(unknown, param)
+		}
+	}
+	sort.Strings(unknown)
+	for _, param := range unknown {
+		violations = append(violations, task.Violation{
+			Field:   param,
+			Message: fmt.Sprintf("%v isn't a known query parameter", param),
+		})
+	}
+
+	limit := defaultLimit
+	if value := values.Get("limit"); value != "" && known["limit"] {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			violations = append(violations, task.Violation{
+				Field:   "limit",
+				Message: fmt.Sprintf("limit must be a number from 1 to %v", maxPageSize),
+			})
+		} else {
+			limit = parsed
+		}
+	}
+
+	return limit, violations
+}
+
+/*
+invalidQuery is the error for query parameters which break the rules.
+*/
+func invalidQuery(violations []task.Violation) requestError {
+	queryErr := newRequestError(http.StatusBadRequest, CodeValidationFailed, "", "Invalid query (%v)", task.ValidationError{Violations: violations}.Messages())
+	queryErr.violations = violations
+	if len(violations) == 1 {
+		queryErr.field = violations[0].Field
+	}
+
+	return queryErr
+}
+
+/*
+run picks out the page of tasks the query asks for, returning a cursor for
+the next page, or "" if this is the last one.
+*/
+func (q taskQuery) run(tasks []*task.Task) ([]*task.Task, string) {
+	matches := make([]*task.Task, 0, len(tasks))
+	for _, t := range tasks {
+		if q.filter.Matches(t) && (q.after == nil || q.ordering.Less(q.after, t)) {
+			matches = append(matches, t)
+		}
+	}
+
+	q.ordering.Sort(matches)
+
+	if q.limit == 0 || len(matches) <= q.limit {
+		return matches, ""
+	}
+
+	page := matches[:q.limit]
+
+	return page, encodeCursor(page[len(page)-1], q.ordering)
+}
+
+func encodeCursor(last *task.Task, ordering task.Ordering) string {
+	contents, _ := json.Marshal(cursor{
+		Sort:         ordering.String(),
+		ID:           last.ID,
+		Name:         last.Name,
+		CreatedDate:  last.CreatedDate,
+		ModifiedDate: last.ModifiedDate,
+		DueDate:      last.DueDate,
+		Priority:     last.Priority,
+	})
+
+	return base64.RawURLEncoding.EncodeToString(contents)
+}
+
+/*
+decodeCursor returns a stand-in for the task a cursor was made from, good
+for comparing against with the ordering. A cursor only makes sense with the
+ordering it was made with.
+*/
+func decodeCursor(encoded string, ordering task.Ordering) (*task.Task, error) {
+	contents, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("cursor isn't valid")
+	}
+
+	var c cursor
+	if err := json.Unmarshal(contents, &c); err != nil || c.ID == "" {
+		return nil, fmt.Errorf("cursor isn't valid")
+	}
+
+	if c.Sort != ordering.String() {
+		return nil, fmt.Errorf("cursor was made for sort=%v, it can't be used with sort=%v", c.Sort, ordering)
+	}
+
+	return &task.Task{
+		ID:           c.ID,
+		Name:         c.Name,
+		CreatedDate:  c.CreatedDate,
+		ModifiedDate: c.ModifiedDate,
+		DueDate:      c.DueDate,
+		Priority:     c.Priority,
+	}, nil
+}
+
+/*
+nextPageURL returns the URL of the page after the one requested.
+*/
+func nextPageURL(request *http.Request, nextCursor string) string {
+	values := request.URL.Query()
+	values.Set("cursor", nextCursor)
+
+	next := *request.URL
+	next.RawQuery = values.Encode()
+
+	return next.RequestURI()
+}
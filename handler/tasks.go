@@ -1,16 +1,15 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 
-	"github.com/jeffbmartinez/log"
-
-	"github.com/jeffbmartinez/todo-persistence/storage"
+	"github.com/jeffbmartinez/todo-persistence/task"
 )
 
 // Tasks handles requests to the /tasks endpoint.
 func Tasks(response http.ResponseWriter, request *http.Request) {
-	handler := BasicResponse(http.StatusMethodNotAllowed)
+	handler := methodNotAllowed
 
 	switch request.Method {
 	case "GET":
@@ -20,13 +19,61 @@ func Tasks(response http.ResponseWriter, request *http.Request) {
 	handler(response, request)
 }
 
+/*
+getTasks lists every root task, each with all its subtasks. Query
+parameters narrow down which root tasks are listed, sort them, split them
+into pages and change how they're laid out:
+
+	complete=true|false
+	category=work (repeat for any of several categories)
+	name=groceries (case insensitive substring)
+	dueAfter, dueBefore, createdAfter, createdBefore, modifiedAfter,
+	modifiedBefore (unix timestamps, after inclusive, before exclusive)
+	sort=name|createdDate|modifiedDate|dueDate|priority (prefix - for
+	descending)
+	limit=50
+	cursor (from the X-Next-Cursor header of the previous page)
+	flat=true (every task listed once, rather than just the root tasks,
+	with parents and subtasks listed by ID)
+	depth=2 (subtasks nested only so many levels deep)
+
+Without a sort, tasks are listed oldest first, whether or not any other
+parameters are given. When there's a next page, its cursor is sent in the
+X-Next-Cursor header and its URL in the Link header.
+
+The tasks' roll-ups count running timers up to the moment they're read, so
+they change without the tasklist changing, and there's no ETag to make the
+request conditional on.
+*/
 func getTasks(response http.ResponseWriter, request *http.Request) {
-	tasklist, err := storage.GetTasklist()
+	query, err := getTaskQuery(request.URL.Query())
 	if err != nil {
-		log.Errorf("Couldn't get tasklist (%v)", err)
-		WriteBasicResponse(http.StatusInternalServerError, response)
+		writeError(err, response, request)
+		return
+	}
+
+	store, ok := getStore(response, request)
+	if !ok {
 		return
 	}
 
-	WriteJSONResponse(response, tasklist.RootTasks, http.StatusOK)
+	store.View(func(tasklist *task.Tasklist) error {
+		tasks := tasklist.RootTasks
+		if query.view.flat {
+			tasks = make([]*task.Task, 0, len(tasklist.Registry))
+			for _, t := range tasklist.Registry {
+				tasks = append(tasks, t)
+			}
+		}
+
+		page, nextCursor := query.run(tasks)
+		if nextCursor != "" {
+			response.Header().Set("X-Next-Cursor", nextCursor)
+			response.Header().Set("Link", fmt.Sprintf(`<%v>; rel="next"`, nextPageURL(request, nextCursor)))
+		}
+
+		WriteJSONResponse(response, query.view.render(page), http.StatusOK)
+
+		return nil
+	})
 }
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+const defaultTextSearchLimit = 20
+
+/*
+textSearchParams lists the query parameters a GET /search request
+understands.
+*/
+var textSearchParams = map[string]bool{
+	"q":     true,
+	"limit": true,
+}
+
+/*
+TextMatch is a task found by a full-text search, with how well it matched.
+Higher scores are better matches.
+*/
+type TextMatch struct {
+	Score float64  `json:"score"`
+	Task  FlatTask `json:"task"`
+}
+
+// TextSearch handles requests to the /search endpoint.
+func TextSearch(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "GET":
+		handler = textSearch
+	}
+
+	handler(response, request)
+}
+
+/*
+textSearch finds the tasks whose name or notes contain every word in the q
+parameter, best matches first. At most limit tasks (20 unless given) are
+listed.
+*/
+func textSearch(response http.ResponseWriter, request *http.Request) {
+	values := request.URL.Query()
+
+	limit, violations := getListParams(values, textSearchParams, defaultTextSearchLimit)
+	if len(violations) > 0 {
+		writeError(invalidQuery(violations), response, request)
+		return
+	}
+
+	q := values.Get("q")
+	if strings.TrimSpace(q) == "" {
+		writeError(newRequestError(http.StatusBadRequest, CodeInvalidQuery, "q", "Search for something with the q parameter"), response, request)
+		return
+	}
+
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	results, err := store.Search(q)
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	store.View(func(tasklist *task.Tasklist) error {
+		rollUps := task.NewRollUps(time.Now())
+		matches := []TextMatch{}
+		for _, result := range results {
+			if len(matches) == limit {
+				break
+			}
+
+			// A task deleted since the search just isn't listed.
+			t, ok := tasklist.Registry[result.ID]
+			if !ok {
+				continue
+			}
+
+			matches = append(matches, TextMatch{
+				Score: result.Score,
+				Task:  newFlatTask(t, rollUps),
+			})
+		}
+
+		WriteJSONResponse(response, matches, http.StatusOK)
+
+		return nil
+	})
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+// StartTimer handles requests to the /tasks/{id}/timer/start endpoint.
+func StartTimer(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "POST":
+		handler = postStartTimer
+	}
+
+	handler(response, request)
+}
+
+// StopTimer handles requests to the /tasks/{id}/timer/stop endpoint.
+func StopTimer(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "POST":
+		handler = postStopTimer
+	}
+
+	handler(response, request)
+}
+
+/*
+postStartTimer starts logging time against the task, responding with the
+new, running, time entry.
+*/
+func postStartTimer(response http.ResponseWriter, request *http.Request) {
+	updateTimer(response, request, func(t *task.Task, now time.Time) (task.TimeEntry, error) {
+		return t.StartTimer(now)
+	})
+}
+
+/*
+postStopTimer stops logging time against the task, responding with the
+finished time entry.
+*/
+func postStopTimer(response http.ResponseWriter, request *http.Request) {
+	updateTimer(response, request, func(t *task.Task, now time.Time) (task.TimeEntry, error) {
+		return t.StopTimer(now)
+	})
+}
+
+func updateTimer(response http.ResponseWriter, request *http.Request, change func(t *task.Task, now time.Time) (task.TimeEntry, error)) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(request)
+	taskID := vars["id"]
+
+	var entry task.TimeEntry
+	err := store.Update(getMutation(request, taskID), func(tasklist *task.Tasklist) error {
+		t, err := tasklist.Get(taskID)
+		if err != nil {
+			return err
+		}
+
+		if ifMatchFails(request, taskETag(t.Revision)) {
+			return errPreconditionFailed
+		}
+
+		entry, err = change(t, time.Now())
+		return err
+	})
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteJSONResponse(response, entry, http.StatusOK)
+}
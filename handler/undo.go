@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+)
+
+// Undo handles requests to the /undo endpoint.
+func Undo(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "POST":
+		handler = postUndo
+	}
+
+	handler(response, request)
+}
+
+// Redo handles requests to the /redo endpoint.
+func Redo(response http.ResponseWriter, request *http.Request) {
+	handler := methodNotAllowed
+
+	switch request.Method {
+	case "POST":
+		handler = postRedo
+	}
+
+	handler(response, request)
+}
+
+func postUndo(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	revision, err := store.Undo(getMutation(request, ""))
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteJSONResponse(response, revision, http.StatusOK)
+}
+
+func postRedo(response http.ResponseWriter, request *http.Request) {
+	store, ok := getStore(response, request)
+	if !ok {
+		return
+	}
+
+	revision, err := store.Redo(getMutation(request, ""))
+	if err != nil {
+		writeError(err, response, request)
+		return
+	}
+
+	WriteJSONResponse(response, revision, http.StatusOK)
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+Dependencies describes what a task is waiting on. Blocked is true while any
+of the tasks blocking it are incomplete.
+*/
+type Dependencies struct {
+	BlockedByIDs []string `json:"blockedByIDs"`
+	Blocked      bool     `json:"blocked"`
+}
+
+func newDependencies(t *task.Task) Dependencies {
+	return Dependencies{
+		BlockedByIDs: getTaskIDs(t.BlockedBy),
+		Blocked:      t.IsBlocked(),
+	}
+}
+
+/*
+FlatTask is a task with its parents and subtasks listed by ID, rather than
+with the subtasks nested inside it.
+*/
+type FlatTask struct {
+	*task.Task
+	Dependencies
+
+	// Sums up the work on the task and everything below it.
+	RollUp task.RollUp `json:"rollUp"`
+
+	ParentIDs  []string `json:"parentIDs"`
+	SubtaskIDs []string `json:"subtaskIDs"`
+
+	// Hides the nested subtasks of the embedded task.
+	Subtasks *struct{} `json:"subtasks,omitempty"`
+}
+
+/*
+newFlatTask lays out a task, taking its roll-up from rollUps, which should
+be shared by every task in the response.
+*/
+func newFlatTask(t *task.Task, rollUps *task.RollUps) FlatTask {
+	return FlatTask{
+		Task:         t,
+		Dependencies: newDependencies(t),
+		RollUp:       rollUps.Get(t),
+		ParentIDs:    getTaskIDs(t.Parents),
+		SubtaskIDs:   getTaskIDs(t.Subtasks),
+	}
+}
+
+/*
+TreeTask is a task with its subtasks nested inside it, all the way down or
+to a limited depth. Every task lists its subtasks by ID, and tasks above
+the depth limit also have them nested.
+*/
+type TreeTask struct {
+	*task.Task
+	Dependencies
+
+	// Sums up the work on the task and everything below it.
+	RollUp task.RollUp `json:"rollUp"`
+
+	SubtaskIDs []string `json:"subtaskIDs"`
+
+	// Replaces the nested subtasks of the embedded task.
+	Subtasks *[]TreeTask `json:"subtasks,omitempty"`
+}
+
+/*
+newTreeTask nests depth levels of subtasks inside the task, or every level
+if depth is negative. Roll-ups are taken from rollUps, which should be
+shared by every task in the response.
+*/
+func newTreeTask(t *task.Task, depth int, rollUps *task.RollUps) TreeTask {
+	tree := TreeTask{
+		Task:         t,
+		Dependencies: newDependencies(t),
+		RollUp:       rollUps.Get(t),
+		SubtaskIDs:   getTaskIDs(t.Subtasks),
+	}
+
+	if depth != 0 {
+		subtasks := make([]TreeTask, 0, len(t.Subtasks))
+		for _, subtask := range t.Subtasks {
+			subtasks = append(subtasks, newTreeTask(subtask, depth-1, rollUps))
+		}
+		tree.Subtasks = &subtasks
+	}
+
+	return tree
+}
+
+/*
+taskView is how tasks are laid out in a response, as asked for by the flat
+and depth query parameters. By default tasks are nested with all their
+subtasks, so a task with several parents appears under each of them. A flat
+view lists every task once, referring to others by ID. A depth limited view
+nests subtasks only so many levels deep.
+*/
+type taskView struct {
+	flat bool
+
+	/*
+		depth is how many levels of subtasks to nest, or -1 for all of them.
+	*/
+	depth int
+}
+
+/*
+getTaskView reads the flat and depth query parameters, returning the rules
+they break if they're wrong.
+*/
+func getTaskView(values url.Values) (taskView, []task.Violation) {
+	view := taskView{depth: -1}
+	violations := []task.Violation{}
+
+	if flat := values.Get("flat"); flat != "" {
+		parsed, err := strconv.ParseBool(flat)
+		if err != nil {
+			violations = append(violations, task.Violation{Field: "flat", Message: "flat must be true or false"})
+		}
+		view.flat = parsed
+	}
+
+	if depth := values.Get("depth"); depth != "" {
+		parsed, err := strconv.Atoi(depth)
+		if err != nil || parsed < 0 {
+			violations = append(violations, task.Violation{Field: "depth", Message: "depth must be 0 or more"})
+		} else if view.flat {
+			violations = append(violations, task.Violation{Field: "depth", Message: "depth can't be used with flat, which doesn't nest tasks at all"})
+		} else {
+			view.depth = parsed
+		}
+	}
+
+	return view, violations
+}
+
+/*
+render lays out tasks, each one listed on its own, as the view asks. In a
+flat view the tasks should already include every task to be listed, as
+subtasks aren't listed along with them.
+*/
+func (v taskView) render(tasks []*task.Task) interface{} {
+	rollUps := task.NewRollUps(time.Now())
+
+	if v.flat {
+		flat := make([]FlatTask, 0, len(tasks))
+		for _, t := range tasks {
+			flat = append(flat, newFlatTask(t, rollUps))
+		}
+		return flat
+	}
+
+	trees := make([]TreeTask, 0, len(tasks))
+	for _, t := range tasks {
+		trees = append(trees, newTreeTask(t, v.depth, rollUps))
+	}
+	return trees
+}
+
+/*
+renderTask lays out a single task, along with its subtasks, as the view
+asks. A flat view lists the task followed by every task below it.
+*/
+func (v taskView) renderTask(tasklist *task.Tasklist, t *task.Task) interface{} {
+	if v.flat {
+		return v.render(append([]*task.Task{t}, tasklist.Descendants(t)...))
+	}
+
+	return newTreeTask(t, v.depth, task.NewRollUps(time.Now()))
+}
@@ -0,0 +1,356 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+ErrTestFailed is the reason given when a "test" operation finds a value
+other than the one it expected.
+*/
+var ErrTestFailed = errors.New("test failed")
+
+/*
+Operation is a single operation of a JSON Patch.
+*/
+type Operation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from"`
+
+	/*
+		Value is left as raw json, so an operation with no value can be told
+		apart from one whose value is null.
+	*/
+	Value json.RawMessage `json:"value"`
+}
+
+/*
+OperationError describes why an operation of a JSON Patch couldn't be
+applied.
+*/
+type OperationError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OperationError) Error() string {
+	return fmt.Sprintf("operation %v (%v %v): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+/*
+Apply applies a JSON Patch, an array of operations, to a json document and
+returns the patched document. Operations are applied in order, and if any of
+them fails the whole patch fails and no patched document is returned.
+*/
+func Apply(document []byte, jsonPatch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+
+	var operations []Operation
+	if err := json.Unmarshal(jsonPatch, &operations); err != nil {
+		return nil, err
+	}
+
+	for i, operation := range operations {
+		var err error
+		target, err = applyOperation(target, operation)
+		if err != nil {
+			return nil, &OperationError{
+				Index: i,
+				Op:    operation.Op,
+				Path:  operation.Path,
+				Err:   err,
+			}
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func applyOperation(target interface{}, operation Operation) (interface{}, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		if len(operation.Value) == 0 {
+			return nil, errors.New("missing value")
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, err
+		}
+
+		switch operation.Op {
+		case "add":
+			return add(target, path, value)
+		case "replace":
+			return replace(target, path, value)
+		}
+
+		current, err := get(target, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, ErrTestFailed
+		}
+
+		return target, nil
+
+	case "remove":
+		return remove(target, path)
+
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(target, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if operation.Op == "copy" {
+			return add(target, path, deepCopy(value))
+		}
+
+		if len(from) < len(path) && reflect.DeepEqual(from, path[:len(from)]) {
+			return nil, errors.New("can't move a value into one of its own children")
+		}
+
+		target, err = remove(target, from)
+		if err != nil {
+			return nil, err
+		}
+
+		return add(target, path, value)
+	}
+
+	return nil, fmt.Errorf("unknown operation '%v'", operation.Op)
+}
+
+/*
+parsePointer splits a JSON Pointer (RFC 6901) into its reference tokens.
+The empty pointer refers to the whole document and has no tokens.
+*/
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path '%v'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+
+	return tokens, nil
+}
+
+func get(target interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		var err error
+		target, err = child(target, token)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return target, nil
+}
+
+func add(target interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return modify(target, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+
+		case []interface{}:
+			index := len(container)
+			if token != "-" {
+				var err error
+				index, err = arrayIndex(token, len(container)+1)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			container = append(container, nil)
+			copy(container[index+1:], container[index:])
+			container[index] = value
+
+			return container, nil
+		}
+
+		return nil, fmt.Errorf("'%v' isn't inside an object or array", token)
+	})
+}
+
+func remove(target interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("can't remove the whole document")
+	}
+
+	return modify(target, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, fmt.Errorf("no member '%v'", token)
+			}
+
+			delete(container, token)
+			return container, nil
+
+		case []interface{}:
+			index, err := arrayIndex(token, len(container))
+			if err != nil {
+				return nil, err
+			}
+
+			return append(container[:index], container[index+1:]...), nil
+		}
+
+		return nil, fmt.Errorf("'%v' isn't inside an object or array", token)
+	})
+}
+
+func replace(target interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return modify(target, path, func(container interface{}, token string) (interface{}, error) {
+		if _, err := child(container, token); err != nil {
+			return nil, err
+		}
+
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+
+		case []interface{}:
+			index, _ := arrayIndex(token, len(container))
+			container[index] = value
+			return container, nil
+		}
+
+		return nil, fmt.Errorf("'%v' isn't inside an object or array", token)
+	})
+}
+
+/*
+modify walks down to the object or array holding the last token of the
+path, replaces it with whatever change returns, and then puts every
+container above it back together on the way up. Arrays can change length,
+so they have to be put back rather than changed in place.
+*/
+func modify(target interface{}, path []string, change func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return change(target, path[0])
+	}
+
+	token := path[0]
+
+	next, err := child(target, token)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err = modify(next, path[1:], change)
+	if err != nil {
+		return nil, err
+	}
+
+	switch target := target.(type) {
+	case map[string]interface{}:
+		target[token] = next
+	case []interface{}:
+		index, _ := arrayIndex(token, len(target))
+		target[index] = next
+	}
+
+	return target, nil
+}
+
+func child(target interface{}, token string) (interface{}, error) {
+	switch target := target.(type) {
+	case map[string]interface{}:
+		value, ok := target[token]
+		if !ok {
+			return nil, fmt.Errorf("no member '%v'", token)
+		}
+
+		return value, nil
+
+	case []interface{}:
+		index, err := arrayIndex(token, len(target))
+		if err != nil {
+			return nil, err
+		}
+
+		return target[index], nil
+	}
+
+	return nil, fmt.Errorf("'%v' isn't inside an object or array", token)
+}
+
+/*
+arrayIndex parses an array index, which must be below limit. Leading zeros
+aren't allowed.
+*/
+func arrayIndex(token string, limit int) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index '%v'", token)
+	}
+
+	if index >= limit {
+		return 0, fmt.Errorf("array index %v out of range", index)
+	}
+
+	return index, nil
+}
+
+func deepCopy(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for name, member := range value {
+			copied[name] = deepCopy(member)
+		}
+		return copied
+
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, element := range value {
+			copied[i] = deepCopy(element)
+		}
+		return copied
+	}
+
+	return value
+}
@@ -0,0 +1,52 @@
+/*
+Package patch applies partial updates to json documents, either as a JSON
+Merge Patch (RFC 7396) or as a JSON Patch (RFC 6902).
+*/
+package patch
+
+import (
+	"encoding/json"
+)
+
+/*
+Merge applies a JSON Merge Patch to a json document and returns the patched
+document. Members of the patch replace the same members of the document,
+objects are merged member by member, and a null member removes that member
+from the document.
+*/
+func Merge(document []byte, mergePatch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+
+	var patch interface{}
+	if err := json.Unmarshal(mergePatch, &patch); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergeValue(target, patch))
+}
+
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+
+	for name, value := range patchObject {
+		if value == nil {
+			delete(targetObject, name)
+			continue
+		}
+
+		targetObject[name] = mergeValue(targetObject[name], value)
+	}
+
+	return targetObject
+}
@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/codegangsta/negroni"
 	"github.com/gorilla/mux"
@@ -12,17 +14,62 @@ import (
 	"github.com/jeffbmartinez/stdoutlog"
 
 	"github.com/jeffbmartinez/todo-persistence/handler"
+	"github.com/jeffbmartinez/todo-persistence/storage"
 )
 
 const projectName string = "todo-persistence"
 const defaultListenPort = 8010
+const jsonStorageSuffix = ".todo.storage"
+const sqliteStorageSuffix = ".todo.sqlite"
+const dataDirEnvironmentVariable = "TODO_DATA_DIR"
+const snapshotDirName = "snapshots"
+const auditDirName = "audit"
+const auditLogSuffix = ".log"
+
+/*
+commandLineArgs holds the settings the server was started with.
+*/
+type commandLineArgs struct {
+	allowAnyHostToConnect bool
+	listenPort            int
+	storageType           string
+	dataDir               string
+	migrateDryRun         bool
+	snapshotPolicy        storage.SnapshotPolicy
+	undoLimit             int
+}
 
 func main() {
 	cleanexit.SetUpSimpleExitOnCtrlC()
 
-	allowAnyHostToConnect, listenPort := getCommandLineArgs()
+	args := getCommandLineArgs()
+
+	if err := os.MkdirAll(args.dataDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't create data directory (%v)\n", err)
+		os.Exit(1)
+	}
+
+	if args.migrateDryRun {
+		if err := reportMigrations(args.storageType, args.dataDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Couldn't check storage for migrations (%v)\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	lists := storage.NewLists(func(listName string) (*storage.Store, error) {
+		return openStore(args, listName)
+	})
+
+	// Open the default list right away, so problems show up at startup.
+	if _, err := lists.Get(storage.DefaultListName); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't load tasks from %v storage (%v)\n", args.storageType, err)
+		os.Exit(1)
+	}
+	handler.UseLists(lists)
 
 	n := negroni.New()
+	n.Use(handler.RequestIDMiddleware{})
 	n.Use(delay.Middleware{})
 	n.Use(stdoutlog.Middleware{})
 
@@ -30,28 +77,160 @@ func main() {
 	n.UseHandler(router)
 
 	listenHost := "localhost"
-	if allowAnyHostToConnect {
+	if args.allowAnyHostToConnect {
 		listenHost = ""
 	}
-	displayServerInfo(listenHost, listenPort)
+	displayServerInfo(listenHost, args.listenPort, args.dataDir)
 
-	listenAddress := fmt.Sprintf("%v:%v", listenHost, listenPort)
+	listenAddress := fmt.Sprintf("%v:%v", listenHost, args.listenPort)
 	n.Run(listenAddress)
 }
 
 func getRouter() *mux.Router {
 	router := mux.NewRouter()
 
+	addListRoutes(router)
+	addListRoutes(router.PathPrefix("/lists/{list}").Subrouter())
+
+	return router
+}
+
+/*
+addListRoutes adds the endpoints for working with a list to a router.
+They're served both at the top level, for the default list, and under
+/lists/{list} for named lists.
+*/
+func addListRoutes(router *mux.Router) {
 	router.HandleFunc("/tasks", handler.Tasks)
 	router.HandleFunc("/tasks/new", handler.NewTask)
+	router.HandleFunc("/tasks/search", handler.SearchTasks)
+	router.HandleFunc("/tasks/next", handler.NextTasks)
 	router.HandleFunc("/tasks/{id}", handler.Task)
+	router.HandleFunc("/tasks/{id}/history", handler.TaskHistory)
+	router.HandleFunc("/tasks/{id}/move", handler.MoveTask)
+	router.HandleFunc("/tasks/{id}/schedule", handler.TaskSchedule)
+	router.HandleFunc("/tasks/{id}/timer/start", handler.StartTimer)
+	router.HandleFunc("/tasks/{id}/timer/stop", handler.StopTimer)
+	router.HandleFunc("/tasks/{id}/dependencies", handler.TaskDependencies)
+	router.HandleFunc("/tasks/{id}/dependencies/{blockerID}", handler.TaskDependency)
 
-	return router
+	router.HandleFunc("/search", handler.TextSearch)
+
+	router.HandleFunc("/undo", handler.Undo)
+	router.HandleFunc("/redo", handler.Redo)
+
+	router.HandleFunc("/admin/snapshots", handler.Snapshots)
+	router.HandleFunc("/admin/restore", handler.Restore)
 }
 
-func getCommandLineArgs() (allowAnyHostToConnect bool, port int) {
-	flag.BoolVar(&allowAnyHostToConnect, "a", false, "Use to allow any ip address (any host) to connect. Default allows ony localhost.")
-	flag.IntVar(&port, "port", defaultListenPort, "Port on which to listen for connections.")
+/*
+openStore opens the named list. Snapshots of the list are kept in a
+directory of its own, and its audit log in a file of its own, under the
+data directory. Its search index is kept in memory, built as it's opened.
+*/
+func openStore(args commandLineArgs, listName string) (*storage.Store, error) {
+	backend, err := getStorageBackend(args.storageType, args.dataDir, listName)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := storage.Open(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshotDir := filepath.Join(args.dataDir, snapshotDirName, listName)
+	store.KeepSnapshots(storage.NewSnapshots(snapshotDir, args.snapshotPolicy))
+
+	auditFilename := filepath.Join(args.dataDir, auditDirName, listName+auditLogSuffix)
+	store.KeepAuditLog(storage.NewAuditLog(auditFilename))
+
+	store.KeepUndoHistory(args.undoLimit)
+	store.KeepSearchIndex()
+
+	return store, nil
+}
+
+/*
+getStorageBackend returns the backend for the named list. The default list
+is stored in a hidden file (".todo.storage" for json), other lists in files
+prefixed with their name ("work.todo.storage").
+*/
+func getStorageBackend(storageType string, dataDir string, listName string) (storage.Backend, error) {
+	prefix := listName
+	if listName == storage.DefaultListName {
+		prefix = ""
+	}
+
+	switch storageType {
+	case "json":
+		return storage.NewJSONFile(filepath.Join(dataDir, prefix+jsonStorageSuffix)), nil
+	case "sqlite":
+		return storage.NewSQLite(filepath.Join(dataDir, prefix+sqliteStorageSuffix))
+	}
+
+	return nil, fmt.Errorf("unknown storage type '%v'", storageType)
+}
+
+/*
+reportMigrations prints what loading each list in the data directory would
+do to bring its storage up to date, without changing anything.
+*/
+func reportMigrations(storageType string, dataDir string) error {
+	suffix := jsonStorageSuffix
+	if storageType == "sqlite" {
+		suffix = sqliteStorageSuffix
+	}
+
+	filenames, err := filepath.Glob(filepath.Join(dataDir, "*"+suffix))
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filenames {
+		var report storage.MigrationReport
+
+		switch storageType {
+		case "json":
+			report, err = storage.NewJSONFile(filename).PlanMigration()
+		case "sqlite":
+			report, err = storage.PlanSQLiteMigration(filename)
+		default:
+			err = fmt.Errorf("unknown storage type '%v'", storageType)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !report.NeedsMigration() {
+			fmt.Printf("%v: up to date (version %v)\n", filename, report.ToVersion)
+			continue
+		}
+
+		fmt.Printf("%v: would migrate from version %v to %v\n", filename, report.FromVersion, report.ToVersion)
+		for _, change := range report.Changes {
+			fmt.Printf("  - %v\n", change)
+		}
+	}
+
+	return nil
+}
+
+func getCommandLineArgs() (args commandLineArgs) {
+	defaultDataDir := os.Getenv(dataDirEnvironmentVariable)
+	if defaultDataDir == "" {
+		defaultDataDir = "."
+	}
+
+	flag.BoolVar(&args.allowAnyHostToConnect, "a", false, "Use to allow any ip address (any host) to connect. Default allows ony localhost.")
+	flag.IntVar(&args.listenPort, "port", defaultListenPort, "Port on which to listen for connections.")
+	flag.StringVar(&args.storageType, "storage", "json", "Where tasks are stored, either 'json' or 'sqlite'.")
+	flag.StringVar(&args.dataDir, "data-dir", defaultDataDir, "Directory tasks are stored in. Defaults to $"+dataDirEnvironmentVariable+" if set, otherwise the current directory.")
+	flag.DurationVar(&args.snapshotPolicy.Interval, "snapshot-interval", time.Hour, "Least amount of time between automatic snapshots of a list. Snapshots are always taken before tasks are deleted.")
+	flag.IntVar(&args.snapshotPolicy.MaxCount, "snapshot-retain", 100, "Most snapshots to keep per list, 0 for no limit.")
+	flag.DurationVar(&args.snapshotPolicy.MaxAge, "snapshot-max-age", 30*24*time.Hour, "How long to keep snapshots for, 0 to keep them forever.")
+	flag.IntVar(&args.undoLimit, "undo-limit", 100, "Most recent changes to each list which can be undone, 0 to disable undo.")
+	flag.BoolVar(&args.migrateDryRun, "migrate-dry-run", false, "Report what would be done to bring stored tasks up to the current storage format, then exit without changing anything.")
 
 	flag.Parse()
 
@@ -62,16 +241,26 @@ func getCommandLineArgs() (allowAnyHostToConnect bool, port int) {
 		os.Exit(2)
 	}
 
+	/* Resolve the data directory now, so it doesn't matter if the working
+	directory changes later on. */
+	dataDir, err := filepath.Abs(args.dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid data directory (%v)\n", err)
+		os.Exit(2)
+	}
+	args.dataDir = dataDir
+
 	return
 }
 
-func displayServerInfo(listenHost string, listenPort int) {
+func displayServerInfo(listenHost string, listenPort int, dataDir string) {
 	visibleTo := listenHost
 	if visibleTo == "" {
 		visibleTo = "All ip addresses"
 	}
 
 	fmt.Printf("%v is running.\n\n", projectName)
-	fmt.Printf("Port: %v\n\n", listenPort)
+	fmt.Printf("Port: %v\n", listenPort)
+	fmt.Printf("Data directory: %v\n\n", dataDir)
 	fmt.Printf("Hit [ctrl-c] to quit\n")
 }
@@ -0,0 +1,65 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+span is the stretch of time a date in a query stands for, as unix
+timestamps, including start but not end. A day spans the whole day, while
+anything more precise spans a single second.
+*/
+type span struct {
+	start int64
+	end   int64
+}
+
+func instant(t time.Time) span {
+	return span{t.Unix(), t.Unix() + 1}
+}
+
+func day(t time.Time) span {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return span{start.Unix(), start.AddDate(0, 0, 1).Unix()}
+}
+
+var relativeUnits = map[byte]time.Duration{
+	'm': time.Minute,
+	'h': time.Hour,
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+}
+
+/*
+parseDate reads a date written in a query. Days are taken to be in now's
+time zone.
+*/
+func parseDate(value string, now time.Time) (span, error) {
+	switch strings.ToLower(value) {
+	case "now":
+		return instant(now), nil
+	case "today":
+		return day(now), nil
+	}
+
+	if date, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return day(date), nil
+	}
+
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return instant(time.Unix(timestamp, 0)), nil
+	}
+
+	if len(value) > 1 {
+		unit, ok := relativeUnits[value[len(value)-1]]
+		count, err := strconv.Atoi(strings.TrimPrefix(value[:len(value)-1], "+"))
+		if ok && err == nil {
+			return instant(now.Add(time.Duration(count) * unit)), nil
+		}
+	}
+
+	return span{}, fmt.Errorf("%v isn't a date (try 2006-01-02, a unix timestamp, now, today or 7d)", value)
+}
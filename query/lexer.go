@@ -0,0 +1,122 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+)
+
+/*
+token is a single piece of a query. Position is where it starts in the
+query, counting bytes from 0.
+*/
+type token struct {
+	kind     tokenKind
+	text     string
+	position int
+}
+
+/*
+SyntaxError describes why a query couldn't be parsed, and where.
+*/
+type SyntaxError struct {
+	Position int
+	Message  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%v at position %v", e.Message, e.Position)
+}
+
+func newSyntaxError(position int, format string, args ...interface{}) *SyntaxError {
+	return &SyntaxError{
+		Position: position,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+/*
+tokenize splits a query into tokens, ending with a tokenEnd.
+*/
+func tokenize(query string) ([]token, error) {
+	tokens := []token{}
+
+	for i := 0; i < len(query); {
+		c := rune(query[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLeftParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRightParen, ")", i})
+			i++
+		case c == ':' || c == '=':
+			tokens = append(tokens, token{tokenOperator, string(c), i})
+			i++
+		case c == '<' || c == '>':
+			operator := string(c)
+			if i+1 < len(query) && query[i+1] == '=' {
+				operator += "="
+			}
+			tokens = append(tokens, token{tokenOperator, operator, i})
+			i += len(operator)
+		case c == '"':
+			text, end, err := readString(query, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, text, i})
+			i = end
+		default:
+			end := i
+			for end < len(query) && !isSeparator(query[end]) {
+				end++
+			}
+			tokens = append(tokens, token{tokenWord, query[i:end], i})
+			i = end
+		}
+	}
+
+	return append(tokens, token{tokenEnd, "", len(query)}), nil
+}
+
+/*
+readString reads the quoted string starting at start, returning its
+contents and the position just past the closing quote. A backslash escapes
+the character after it.
+*/
+func readString(query string, start int) (string, int, error) {
+	var text strings.Builder
+
+	for i := start + 1; i < len(query); i++ {
+		switch query[i] {
+		case '"':
+			return text.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(query) {
+				i++
+			}
+		}
+		text.WriteByte(query[i])
+	}
+
+	return "", 0, newSyntaxError(start, "unterminated string")
+}
+
+func isSeparator(c byte) bool {
+	return strings.IndexByte(" \t\r\n()\":=<>", c) != -1
+}
@@ -0,0 +1,196 @@
+package query
+
+import (
+	"strings"
+	"time"
+)
+
+/*
+parser turns the tokens of a query into a tree of nodes, using the grammar
+
+	query   = or
+	or      = and { "OR" and }
+	and     = not { [ "AND" ] not }
+	not     = "NOT" not | primary
+	primary = "(" or ")" | term
+	term    = word operator value | word | string
+
+Terms written next to each other without an operator are joined with AND.
+*/
+type parser struct {
+	tokens []token
+	next   int
+	now    time.Time
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEnd {
+		p.next++
+	}
+
+	return t
+}
+
+/*
+isKeyword returns true if the token is the keyword. Keywords must be
+written in upper case, so "and", "or" and "not" can still be searched for.
+*/
+func isKeyword(t token, keyword string) bool {
+	return t.kind == tokenWord && t.text == keyword
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for isKeyword(p.peek(), "OR") {
+		p.advance()
+
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = orNode{left, right}
+	}
+
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		next := p.peek()
+		if next.kind == tokenEnd || next.kind == tokenRightParen || isKeyword(next, "OR") {
+			return left, nil
+		}
+
+		if isKeyword(next, "AND") {
+			p.advance()
+		}
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		left = andNode{left, right}
+	}
+}
+
+func (p *parser) parseNot() (node, error) {
+	if isKeyword(p.peek(), "NOT") {
+		p.advance()
+
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return notNode{operand}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	next := p.advance()
+
+	switch next.kind {
+	case tokenLeftParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if closing := p.advance(); closing.kind != tokenRightParen {
+			return nil, newSyntaxError(closing.position, "expected )")
+		}
+
+		return inner, nil
+	case tokenString:
+		return nameNode{value: next.text}, nil
+	case tokenWord:
+		if isKeyword(next, "AND") || isKeyword(next, "OR") {
+			return nil, newSyntaxError(next.position, "expected a term before %v", next.text)
+		}
+
+		if p.peek().kind == tokenOperator {
+			return p.parseField(next)
+		}
+
+		if strings.EqualFold(next.text, "complete") {
+			return completeNode{true}, nil
+		}
+
+		return nameNode{value: next.text}, nil
+	case tokenEnd:
+		return nil, newSyntaxError(next.position, "unexpected end of query")
+	}
+
+	return nil, newSyntaxError(next.position, "unexpected %v", next.text)
+}
+
+/*
+parseField parses a term comparing a field of a task with a value.
+*/
+func (p *parser) parseField(field token) (node, error) {
+	operator := p.advance()
+
+	value := p.advance()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, newSyntaxError(value.position, "expected a value after %v%v", field.text, operator.text)
+	}
+
+	name := strings.ToLower(field.text)
+
+	if builder, ok := dateFields[name]; ok {
+		span, err := parseDate(value.text, p.now)
+		if err != nil {
+			return nil, newSyntaxError(value.position, "%v", err)
+		}
+
+		return dateNode{field: builder, operator: operator.text, span: span}, nil
+	}
+
+	if operator.text != ":" && operator.text != "=" {
+		return nil, newSyntaxError(operator.position, "%v can't be compared with %v", field.text, operator.text)
+	}
+
+	switch name {
+	case "name":
+		return nameNode{value: value.text, exact: operator.text == "="}, nil
+	case "category":
+		return categoryNode{value.text}, nil
+	case "complete":
+		switch strings.ToLower(value.text) {
+		case "true", "yes":
+			return completeNode{true}, nil
+		case "false", "no":
+			return completeNode{false}, nil
+		}
+
+		return nil, newSyntaxError(value.position, "complete must be true or false")
+	case "id":
+		return idNode{value.text}, nil
+	case "series":
+		return seriesNode{value.text}, nil
+	case "parent":
+		return parentNode{value.text}, nil
+	case "ancestor":
+		return ancestorNode{value.text}, nil
+	}
+
+	return nil, newSyntaxError(field.position, "unknown field %v", field.text)
+}
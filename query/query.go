@@ -0,0 +1,262 @@
+/*
+Package query parses and runs searches over the tasks of a tasklist, written
+in a small query language:
+
+	category:work AND due<7d AND NOT complete AND ancestor:"Q3 launch"
+
+A query is made of terms joined with AND, OR and NOT (in upper case), and
+grouped with parentheses. Terms side by side are joined with AND. A term is
+either a word or "quoted string", matching tasks whose name contains it, or
+a field compared with a value:
+
+	name:milk          name contains milk (name= for the whole name)
+	category:work      in the work category
+	complete           complete (complete:false for incomplete)
+	id:ID              the task with that ID
+	series:ID          an occurrence of the recurring task with that ID
+	parent:X           a direct subtask of a task named X (or with ID X)
+	ancestor:X         anywhere below a task named X (or with ID X)
+	due, created, modified
+	                   compared with : = < <= > or >= against a date
+
+Dates are written as 2006-01-02 (the whole day), unix timestamps, now,
+today, or times relative to now such as 7d, -2w, 12h or 30m. Tasks without
+a due date never match a due date comparison.
+*/
+package query
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+Query is a parsed query, ready to be run.
+*/
+type Query struct {
+	root node
+}
+
+/*
+Parse parses a query. Relative dates in the query are taken to be relative
+to now. A query which can't be parsed returns a *SyntaxError.
+*/
+func Parse(query string, now time.Time) (Query, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return Query{}, err
+	}
+
+	p := parser{tokens: tokens, now: now}
+	if p.peek().kind == tokenEnd {
+		return Query{}, newSyntaxError(0, "empty query")
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return Query{}, err
+	}
+
+	if rest := p.peek(); rest.kind != tokenEnd {
+		return Query{}, newSyntaxError(rest.position, "unexpected %v", rest.text)
+	}
+
+	return Query{root: root}, nil
+}
+
+/*
+Matches returns true if the task, which must belong to the tasklist, matches
+the query.
+*/
+func (q Query) Matches(tasklist *task.Tasklist, t *task.Task) bool {
+	return q.root.match(tasklist, t)
+}
+
+/*
+Search returns every task in the tasklist matching the query, oldest first.
+*/
+func Search(tasklist *task.Tasklist, q Query) []*task.Task {
+	matches := []*task.Task{}
+	for _, t := range tasklist.Registry {
+		if q.Matches(tasklist, t) {
+			matches = append(matches, t)
+		}
+	}
+
+	task.Ordering{Field: task.SortByCreatedDate}.Sort(matches)
+
+	return matches
+}
+
+/*
+Paths returns every path from a root task down to the task, not counting
+the task itself. Each path starts at a root task and ends at one of the
+task's parents. A root task has a single, empty path.
+*/
+func Paths(t *task.Task) [][]*task.Task {
+	if t.IsRootTask() {
+		return [][]*task.Task{{}}
+	}
+
+	paths := [][]*task.Task{}
+	for _, parent := range t.Parents {
+		for _, path := range Paths(parent) {
+			full := make([]*task.Task, 0, len(path)+1)
+			paths = append(paths, append(append(full, path...), parent))
+		}
+	}
+
+	return paths
+}
+
+/*
+node is a part of a parsed query.
+*/
+type node interface {
+	match(tasklist *task.Tasklist, t *task.Task) bool
+}
+
+type andNode struct {
+	left  node
+	right node
+}
+
+func (n andNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	return n.left.match(tasklist, t) && n.right.match(tasklist, t)
+}
+
+type orNode struct {
+	left  node
+	right node
+}
+
+func (n orNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	return n.left.match(tasklist, t) || n.right.match(tasklist, t)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n notNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	return !n.operand.match(tasklist, t)
+}
+
+type nameNode struct {
+	value string
+	exact bool
+}
+
+func (n nameNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	if n.exact {
+		return strings.EqualFold(t.Name, n.value)
+	}
+
+	return strings.Contains(strings.ToLower(t.Name), strings.ToLower(n.value))
+}
+
+type categoryNode struct {
+	value string
+}
+
+func (n categoryNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	for _, category := range t.Categories {
+		if strings.EqualFold(category, n.value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type completeNode struct {
+	complete bool
+}
+
+func (n completeNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	return t.Complete == n.complete
+}
+
+type idNode struct {
+	id string
+}
+
+func (n idNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	return t.ID == n.id
+}
+
+type seriesNode struct {
+	seriesID string
+}
+
+func (n seriesNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	return t.SeriesID == n.seriesID || (t.SeriesID == "" && t.ID == n.seriesID)
+}
+
+type parentNode struct {
+	value string
+}
+
+func (n parentNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	return anyNamed(t.Parents, n.value)
+}
+
+type ancestorNode struct {
+	value string
+}
+
+func (n ancestorNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	return anyNamed(tasklist.Ancestors(t), n.value)
+}
+
+/*
+anyNamed returns true if any of the tasks has the name (ignoring case) or
+the ID given.
+*/
+func anyNamed(tasks []*task.Task, nameOrID string) bool {
+	for _, t := range tasks {
+		if t.ID == nameOrID || strings.EqualFold(t.Name, nameOrID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type dateNode struct {
+	field    func(t *task.Task) int64
+	operator string
+	span     span
+}
+
+/*
+match compares the date with the whole span, so due<2006-01-02 means due
+before that day starts, and due<=2006-01-02 means due before it ends.
+*/
+func (n dateNode) match(tasklist *task.Tasklist, t *task.Task) bool {
+	value := n.field(t)
+	if value == 0 {
+		return false
+	}
+
+	switch n.operator {
+	case "<":
+		return value < n.span.start
+	case "<=":
+		return value < n.span.end
+	case ">":
+		return value >= n.span.end
+	case ">=":
+		return value >= n.span.start
+	}
+
+	return value >= n.span.start && value < n.span.end
+}
+
+var dateFields = map[string]func(t *task.Task) int64{
+	"due":      func(t *task.Task) int64 { return t.DueDate },
+	"created":  func(t *task.Task) int64 { return t.CreatedDate },
+	"modified": func(t *task.Task) int64 { return t.ModifiedDate },
+}
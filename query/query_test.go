@@ -0,0 +1,100 @@
+package query
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+func buildTasklist(t *testing.T, now time.Time) *task.Tasklist {
+	tasklist := task.NewTasklist()
+
+	launch, _ := tasklist.CreateTask("Q3 launch", nil)
+	docs, _ := tasklist.CreateTask("Write docs", []string{launch.ID})
+	review, _ := tasklist.CreateTask("Review docs", []string{docs.ID})
+	chores, _ := tasklist.CreateTask("Chores", nil)
+
+	docs.Categories = []string{"work"}
+	docs.DueDate = now.Add(3 * 24 * time.Hour).Unix()
+	review.Categories = []string{"work"}
+	review.DueDate = now.Add(10 * 24 * time.Hour).Unix()
+	chores.Categories = []string{"home"}
+	chores.DueDate = now.Add(24 * time.Hour).Unix()
+
+	if err := tasklist.Link(chores, review); err != nil {
+		t.Fatal(err)
+	}
+
+	return &tasklist
+}
+
+func searchNames(t *testing.T, tasklist *task.Tasklist, q string, now time.Time) string {
+	parsed, err := Parse(q, now)
+	if err != nil {
+		t.Fatalf("Couldn't parse %q (%v)", q, err)
+	}
+
+	names := []string{}
+	for _, match := range Search(tasklist, parsed) {
+		names = append(names, match.Name)
+	}
+
+	// Tasks created in the same second come out in ID order, which is random.
+	sort.Strings(names)
+
+	return strings.Join(names, ",")
+}
+
+func TestSearch(t *testing.T) {
+	now := time.Now()
+	tasklist := buildTasklist(t, now)
+
+	searches := map[string]string{
+		`category:work AND due<7d AND NOT complete AND ancestor:"Q3 launch"`: "Write docs",
+		`category:work ancestor:"q3 launch"`:                                 "Review docs,Write docs",
+		`docs OR chores`:                                                     "Chores,Review docs,Write docs",
+		`parent:chores`:                                                      "Review docs",
+		`NOT (category:work OR category:home)`:                               "Q3 launch",
+		`due>=today complete:false category:home`:                            "Chores",
+		`name="review docs"`:                                                 "Review docs",
+		`complete`:                                                           "",
+	}
+
+	for q, expected := range searches {
+		if actual := searchNames(t, tasklist, q, now); actual != expected {
+			t.Errorf("Expected %q to find %q, got %q", q, expected, actual)
+		}
+	}
+}
+
+func TestPaths(t *testing.T) {
+	tasklist := buildTasklist(t, time.Now())
+
+	parsed, _ := Parse(`name="review docs"`, time.Now())
+	review := Search(tasklist, parsed)[0]
+
+	paths := []string{}
+	for _, path := range Paths(review) {
+		names := []string{}
+		for _, step := range path {
+			names = append(names, step.Name)
+		}
+		paths = append(paths, strings.Join(names, "/"))
+	}
+
+	if strings.Join(paths, ";") != "Q3 launch/Write docs;Chores" {
+		t.Fatalf("Expected a path through each parent, got %q", paths)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, q := range []string{``, `(work`, `due<soon`, `color:red`, `category<work`, `"open`, `work OR`} {
+		_, err := Parse(q, time.Now())
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("Expected %q to be a syntax error, got %v", q, err)
+		}
+	}
+}
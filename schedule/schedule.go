@@ -0,0 +1,323 @@
+/*
+Package schedule works out when the tasks below a task can be done, using
+the critical path method over task estimates and dependencies.
+
+The tasks of a schedule are a task and everything below it. A task can't
+start until its subtasks are done, as the task itself is the work left
+once they are, and until the tasks blocking it are done. Incomplete
+blockers outside the subtree hold the work up just the same, so they're
+scheduled too, along with whatever they wait on in turn, and marked as
+external. Complete tasks take no time, and incomplete ones take their
+estimate.
+
+Times are in seconds from the start of the work, which is when every task
+with nothing to wait on can start.
+*/
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+Entry is where a single task falls in a schedule. Slack is how long the
+task can slip (start after EarliestStart) without making the whole
+schedule longer. Tasks without slack are critical. External is true for
+tasks outside the root's subtree, which tasks in it wait on.
+*/
+type Entry struct {
+	Task     *task.Task
+	Duration int64
+	External bool
+
+	EarliestStart  int64
+	EarliestFinish int64
+	LatestStart    int64
+	LatestFinish   int64
+	Slack          int64
+	Critical       bool
+
+	predecessors []*Entry
+	successors   []*Entry
+
+	// position is where the task was found walking down from the root,
+	// and rank where it ended up in topological order.
+	position int
+	rank     int
+}
+
+/*
+Schedule is the result of scheduling the tasks below a task.
+
+Order holds every task of the schedule in topological order, so each task
+comes after the tasks it waits on. CriticalPath is the chain of critical
+tasks, first to last, which decides how long the work takes. Duration is
+how long that is, the earliest the root task can be finished.
+*/
+type Schedule struct {
+	Root         *task.Task
+	Order        []*Entry
+	CriticalPath []*Entry
+	Duration     int64
+
+	entries map[string]*Entry
+}
+
+/*
+CycleError is used to signify that the tasks of a schedule wait on each
+other in a circle, through subtasks and blockers together (a subtask
+blocked by its own parent, say), so they can't be put in any order. The
+task package refuses edges which would make such a circle, so only
+tasklists built some other way can have one.
+TaskIDs lists the tasks which couldn't be ordered, those in the circle and
+those waiting on them.
+*/
+type CycleError struct {
+	TaskIDs []string
+}
+
+func (c CycleError) Error() string {
+	return fmt.Sprintf("Tasks %v wait on each other, so they can't be scheduled", strings.Join(c.TaskIDs, ", "))
+}
+
+/*
+New schedules root and every task below it, along with the incomplete tasks
+outside it they wait on.
+*/
+func New(tasklist task.Tasklist, root *task.Task) (*Schedule, error) {
+	s := &Schedule{
+		Root:    root,
+		entries: make(map[string]*Entry),
+	}
+
+	tasks := append([]*task.Task{root}, tasklist.Descendants(root)...)
+	for position, t := range tasks {
+		s.entries[t.ID] = &Entry{
+			Task:     t,
+			Duration: duration(t),
+			position: position,
+		}
+	}
+
+	// Go on to the tasks outside the subtree which are waited on, and the
+	// ones those wait on, until there are no more. Complete ones don't
+	// hold anything up.
+	for i := 0; i < len(tasks); i++ {
+		for _, t := range tasks[i].WaitingOn() {
+			if _, ok := s.entries[t.ID]; ok || t.Complete {
+				continue
+			}
+
+			s.entries[t.ID] = &Entry{
+				Task:     t,
+				Duration: duration(t),
+				External: true,
+				position: len(tasks),
+			}
+			tasks = append(tasks, t)
+		}
+	}
+
+	for _, entry := range s.entries {
+		for _, t := range entry.Task.WaitingOn() {
+			predecessor, ok := s.entries[t.ID]
+			if !ok || hasEntry(entry.predecessors, predecessor) {
+				continue
+			}
+
+			entry.predecessors = append(entry.predecessors, predecessor)
+			predecessor.successors = append(predecessor.successors, entry)
+		}
+	}
+
+	order, err := s.sort()
+	if err != nil {
+		return nil, err
+	}
+	s.Order = order
+
+	s.forwardPass()
+	s.backwardPass()
+	s.CriticalPath = s.criticalPath()
+
+	return s, nil
+}
+
+/*
+Get returns the entry for a task, or false if the task isn't part of the
+schedule.
+*/
+func (s *Schedule) Get(taskID string) (*Entry, bool) {
+	entry, ok := s.entries[taskID]
+	return entry, ok
+}
+
+/*
+duration is how much work is left on a task.
+*/
+func duration(t *task.Task) int64 {
+	if t.Complete {
+		return 0
+	}
+
+	return t.Estimate
+}
+
+/*
+sort puts the entries in topological order. Among the tasks ready to go
+next, the one found first walking down from the root goes first, so the
+same tasks always come out in the same order.
+*/
+func (s *Schedule) sort() ([]*Entry, error) {
+	waiting := make(map[*Entry]int)
+	ready := []*Entry{}
+	for _, entry := range s.entries {
+		waiting[entry] = len(entry.predecessors)
+		if waiting[entry] == 0 {
+			ready = append(ready, entry)
+		}
+	}
+	sortByPosition(ready)
+
+	order := make([]*Entry, 0, len(s.entries))
+	for len(ready) > 0 {
+		entry := ready[0]
+		ready = ready[1:]
+
+		entry.rank = len(order)
+		order = append(order, entry)
+
+		for _, successor := range entry.successors {
+			waiting[successor]--
+			if waiting[successor] == 0 {
+				ready = insertByPosition(ready, successor)
+			}
+		}
+	}
+
+	if len(order) < len(s.entries) {
+		stuck := []*Entry{}
+		for entry, count := range waiting {
+			if count > 0 {
+				stuck = append(stuck, entry)
+			}
+		}
+		sortByPosition(stuck)
+
+		taskIDs := make([]string, 0, len(stuck))
+		for _, entry := range stuck {
+			taskIDs = append(taskIDs, entry.Task.ID)
+		}
+
+		return nil, CycleError{TaskIDs: taskIDs}
+	}
+
+	return order, nil
+}
+
+/*
+forwardPass works out the earliest each task can start and finish, along
+with how long the whole schedule takes.
+*/
+func (s *Schedule) forwardPass() {
+	for _, entry := range s.Order {
+		entry.EarliestStart = 0
+		for _, predecessor := range entry.predecessors {
+			if predecessor.EarliestFinish > entry.EarliestStart {
+				entry.EarliestStart = predecessor.EarliestFinish
+			}
+		}
+
+		entry.EarliestFinish = entry.EarliestStart + entry.Duration
+		if entry.EarliestFinish > s.Duration {
+			s.Duration = entry.EarliestFinish
+		}
+	}
+}
+
+/*
+backwardPass works out the latest each task can start and finish without
+holding up the schedule, and so the slack each task has.
+*/
+func (s *Schedule) backwardPass() {
+	for i := len(s.Order) - 1; i >= 0; i-- {
+		entry := s.Order[i]
+
+		entry.LatestFinish = s.Duration
+		for _, successor := range entry.successors {
+			if successor.LatestStart < entry.LatestFinish {
+				entry.LatestFinish = successor.LatestStart
+			}
+		}
+
+		entry.LatestStart = entry.LatestFinish - entry.Duration
+		entry.Slack = entry.LatestStart - entry.EarliestStart
+		entry.Critical = entry.Slack == 0
+	}
+}
+
+/*
+criticalPath follows critical tasks back from the critical task which
+finishes last, through predecessors that finish just as their successor
+starts. Where there's more than one such predecessor, the first in
+topological order is taken.
+*/
+func (s *Schedule) criticalPath() []*Entry {
+	var last *Entry
+	for _, entry := range s.Order {
+		if entry.Critical && entry.EarliestFinish == s.Duration {
+			last = entry
+		}
+	}
+
+	path := []*Entry{}
+	for entry := last; entry != nil; {
+		path = append(path, entry)
+
+		var next *Entry
+		for _, predecessor := range entry.predecessors {
+			if predecessor.Critical && predecessor.EarliestFinish == entry.EarliestStart && (next == nil || predecessor.rank < next.rank) {
+				next = predecessor
+			}
+		}
+		entry = next
+	}
+
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+
+	return path
+}
+
+func hasEntry(entries []*Entry, entry *Entry) bool {
+	for _, e := range entries {
+		if e == entry {
+			return true
+		}
+	}
+
+	return false
+}
+
+func sortByPosition(entries []*Entry) {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].position < entries[j].position
+	})
+}
+
+func insertByPosition(entries []*Entry, entry *Entry) []*Entry {
+	i := sort.Search(len(entries), func(i int) bool {
+		return entries[i].position > entry.position
+	})
+
+	entries = append(entries, nil)
+	copy(entries[i+1:], entries[i:])
+	entries[i] = entry
+
+	return entries
+}
@@ -0,0 +1,146 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+const hour = 60 * 60
+
+func names(entries []*Entry) string {
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Task.Name)
+	}
+
+	return strings.Join(names, ",")
+}
+
+func TestSchedule(t *testing.T) {
+	tasklist := task.NewTasklist()
+
+	release, _ := tasklist.CreateTask("release", nil)
+	design, _ := tasklist.CreateTask("design", []string{release.ID})
+	build, _ := tasklist.CreateTask("build", []string{release.ID})
+	docs, _ := tasklist.CreateTask("docs", []string{release.ID})
+	test, _ := tasklist.CreateTask("test", []string{release.ID})
+	outside, _ := tasklist.CreateTask("outside", nil)
+
+	// The outside blocker is done, so it holds nothing up.
+	outside.Complete = true
+
+	release.Estimate = 1 * hour
+	design.Estimate = 2 * hour
+	build.Estimate = 5 * hour
+	docs.Estimate = 3 * hour
+	test.Estimate = 2 * hour
+	outside.Estimate = 100 * hour
+
+	build.AddBlocker(design)
+	docs.AddBlocker(design)
+	test.AddBlocker(build)
+	design.AddBlocker(outside)
+
+	s, err := New(tasklist, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(s.Order); got != "design,build,docs,test,release" {
+		t.Errorf("Wrong topological order, got %v", got)
+	}
+
+	if got := names(s.CriticalPath); got != "design,build,test,release" {
+		t.Errorf("Wrong critical path, got %v", got)
+	}
+
+	if s.Duration != 10*hour {
+		t.Errorf("Schedule should take 10 hours, not %v seconds", s.Duration)
+	}
+
+	entry, _ := s.Get(docs.ID)
+	if entry.EarliestStart != 2*hour || entry.LatestStart != 6*hour || entry.Slack != 4*hour || entry.Critical {
+		t.Errorf("Docs should start from 2 to 6 hours in with 4 hours of slack, got %+v", entry)
+	}
+
+	if _, ok := s.Get(outside.ID); ok {
+		t.Error("Complete blockers outside the subtree shouldn't be scheduled")
+	}
+
+	// Finished work takes no time, moving the critical path to docs.
+	build.Complete = true
+
+	s, err = New(tasklist, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(s.CriticalPath); got != "design,docs,release" || s.Duration != 6*hour {
+		t.Errorf("Expected design,docs,release taking 6 hours, got %v taking %v seconds", got, s.Duration)
+	}
+}
+
+func TestScheduleWaitsOnOutsideBlockers(t *testing.T) {
+	tasklist := task.NewTasklist()
+
+	release, _ := tasklist.CreateTask("release", nil)
+	build, _ := tasklist.CreateTask("build", []string{release.ID})
+	other, _ := tasklist.CreateTask("other project", nil)
+	api, _ := tasklist.CreateTask("api", []string{other.ID})
+	schema, _ := tasklist.CreateTask("schema", []string{api.ID})
+	done, _ := tasklist.CreateTask("done", nil)
+
+	build.Estimate = 2 * hour
+	api.Estimate = 3 * hour
+	schema.Estimate = 4 * hour
+	done.Estimate = 50 * hour
+	done.Complete = true
+
+	build.AddBlocker(api)
+	build.AddBlocker(done)
+
+	s, err := New(tasklist, release)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := names(s.CriticalPath); got != "schema,api,build,release" || s.Duration != 9*hour {
+		t.Errorf("Expected schema,api,build,release taking 9 hours, got %v taking %v seconds", got, s.Duration)
+	}
+
+	if entry, ok := s.Get(api.ID); !ok || !entry.External {
+		t.Errorf("Expected the outside blocker to be scheduled as external")
+	}
+	if entry, ok := s.Get(build.ID); !ok || entry.External {
+		t.Errorf("Expected tasks in the subtree not to be external")
+	}
+	for _, left := range []*task.Task{other, done} {
+		if _, ok := s.Get(left.ID); ok {
+			t.Errorf("Expected %v not to be scheduled, nothing waits on it or it's done", left.Name)
+		}
+	}
+}
+
+func TestScheduleCycle(t *testing.T) {
+	tasklist := task.NewTasklist()
+
+	parent, _ := tasklist.CreateTask("parent", nil)
+	subtask, _ := tasklist.CreateTask("subtask", []string{parent.ID})
+	other, _ := tasklist.CreateTask("other", []string{parent.ID})
+
+	// The task package refuses to make this cycle, so make it by hand.
+	subtask.BlockedBy = append(subtask.BlockedBy, parent)
+	parent.Blocks = append(parent.Blocks, subtask)
+
+	_, err := New(tasklist, parent)
+	cycleErr, ok := err.(CycleError)
+	if !ok {
+		t.Fatalf("Expected a CycleError, got %v", err)
+	}
+
+	if got := strings.Join(cycleErr.TaskIDs, ","); got != parent.ID+","+subtask.ID {
+		t.Errorf("Expected the parent and subtask to be stuck, got %v (other is %v)", got, other.ID)
+	}
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ErrAuditLogDisabled is returned by a Store which doesn't keep an audit log.
+*/
+var ErrAuditLogDisabled = errors.New("Audit log is not enabled")
+
+/*
+Audit actions, describing what happened to a task.
+*/
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+)
+
+/*
+unauditedFields are task fields which change as a side effect of every
+change, and so aren't worth recording.
+*/
+var unauditedFields = map[string]bool{
+	"Revision":     true,
+	"ModifiedDate": true,
+}
+
+/*
+Mutation describes a change being made to a tasklist, so it can be recorded
+in the audit log.
+*/
+type Mutation struct {
+	/*
+		Actor is whoever asked for the change.
+	*/
+	Actor string
+
+	/*
+		Operation is what they asked for, such as "PUT /tasks/{id}".
+	*/
+	Operation string
+
+	/*
+		TaskID is the task the change was aimed at, if there was one. Any
+		other task changed along the way (a parent being completed because
+		its last subtask was, for example) was changed as a cascade.
+	*/
+	TaskID string
+}
+
+/*
+FieldChange records the value of a single task field before and after a
+change. A task being created has no before values, one being deleted has
+no after values.
+*/
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+/*
+AuditEvent records a change made to a single task.
+*/
+type AuditEvent struct {
+	Time      int64  `json:"time"`
+	Actor     string `json:"actor"`
+	Operation string `json:"operation"`
+
+	TaskID string `json:"taskID"`
+	Action string `json:"action"`
+
+	/*
+		CauseID is the task the operation was aimed at. When it isn't this
+		event's task, Cascade is true.
+	*/
+	CauseID string `json:"causeID,omitempty"`
+	Cascade bool   `json:"cascade"`
+
+	Changes []FieldChange `json:"changes"`
+}
+
+/*
+AuditLog is an append-only file of audit events, one json event per line.
+*/
+type AuditLog struct {
+	filename string
+}
+
+/*
+NewAuditLog returns an audit log kept in the named file. The file (and its
+directory) is created when the first events are recorded.
+*/
+func NewAuditLog(filename string) *AuditLog {
+	return &AuditLog{
+		filename: filename,
+	}
+}
+
+/*
+Record appends events to the log.
+*/
+func (a *AuditLog) Record(events []AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var lines []byte
+	for _, event := range events {
+		line, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines, line...)
+		lines = append(lines, '\n')
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.filename), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(a.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(lines)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+/*
+History returns every event recorded for a task, oldest first. The history
+of a deleted task is still available.
+*/
+func (a *AuditLog) History(taskID string) ([]AuditEvent, error) {
+	file, err := os.Open(a.filename)
+	if os.IsNotExist(err) {
+		return []AuditEvent{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	events := []AuditEvent{}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// Most likely a torn write at the end of the log.
+			continue
+		}
+
+		if event.TaskID == taskID {
+			events = append(events, event)
+		}
+	}
+
+	return events, scanner.Err()
+}
+
+/*
+auditEvents describes a changeset as one audit event per changed task.
+*/
+func auditEvents(mutation Mutation, before map[string]Task, changes Changeset, now int64) []AuditEvent {
+	newEvent := func(taskID string, action string, changes []FieldChange) AuditEvent {
+		return AuditEvent{
+			Time:      now,
+			Actor:     mutation.Actor,
+			Operation: mutation.Operation,
+			TaskID:    taskID,
+			Action:    action,
+			CauseID:   mutation.TaskID,
+			Cascade:   mutation.TaskID != "" && mutation.TaskID != taskID,
+			Changes:   changes,
+		}
+	}
+
+	events := make([]AuditEvent, 0, len(changes.Puts)+len(changes.Deletes))
+
+	for _, after := range changes.Puts {
+		previous, existed := before[after.ID]
+
+		action := AuditActionUpdate
+		if !existed {
+			action = AuditActionCreate
+		}
+
+		events = append(events, newEvent(after.ID, action, diffFields(previous, existed, after, true)))
+	}
+
+	for _, taskID := range changes.Deletes {
+		events = append(events, newEvent(taskID, AuditActionDelete, diffFields(before[taskID], true, Task{}, false)))
+	}
+
+	return events
+}
+
+/*
+diffFields compares every field of two versions of a task and returns the
+ones which differ. A version which doesn't exist has no values at all,
+rather than zero values.
+*/
+func diffFields(before Task, beforeExists bool, after Task, afterExists bool) []FieldChange {
+	beforeValue := reflect.ValueOf(before)
+	afterValue := reflect.ValueOf(after)
+	taskType := beforeValue.Type()
+
+	changes := []FieldChange{}
+	for i := 0; i < taskType.NumField(); i++ {
+		name := taskType.Field(i).Name
+		if unauditedFields[name] {
+			continue
+		}
+
+		var change FieldChange
+		change.Field = lowerFirst(name)
+
+		if beforeExists {
+			change.Before = beforeValue.Field(i).Interface()
+		}
+		if afterExists {
+			change.After = afterValue.Field(i).Interface()
+		}
+
+		if beforeExists && afterExists && reflect.DeepEqual(change.Before, change.After) {
+			continue
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+/*
+lowerFirst turns a Go field name into the name used for it in json
+("DueDate" becomes "dueDate", "ID" becomes "id").
+*/
+func lowerFirst(name string) string {
+	if strings.ToUpper(name) == name {
+		return strings.ToLower(name)
+	}
+
+	first, size := utf8.DecodeRuneInString(name)
+
+	return string(unicode.ToLower(first)) + name[size:]
+}
@@ -0,0 +1,46 @@
+package storage
+
+/*
+Backend is implemented by anything capable of persisting tasks. Backends
+deal only in the serializable Task form, turning those into a connected
+task.Tasklist is left to the storage package itself.
+
+Backends are not expected to do their own locking, the storage package
+serializes all calls made to the active backend.
+*/
+type Backend interface {
+	/*
+		Load retrieves every stored task. A backend with nothing stored yet
+		returns an empty slice rather than an error.
+	*/
+	Load() ([]Task, error)
+
+	/*
+		Save replaces everything stored with the supplied tasks.
+	*/
+	Save(tasks []Task) error
+
+	/*
+		GetTask retrieves a single task. If no task with the supplied ID is
+		stored, a task.NotFoundError is returned.
+	*/
+	GetTask(taskID string) (Task, error)
+
+	/*
+		Apply stores every put and removes every delete in the changeset as
+		a single unit.
+	*/
+	Apply(changes Changeset) error
+
+	/*
+		PutTask stores a single task, replacing any stored task with the
+		same ID.
+	*/
+	PutTask(t Task) error
+
+	/*
+		DeleteTask removes a single task. Deleting a task which isn't stored
+		is not an error.
+	*/
+	DeleteTask(taskID string) error
+}
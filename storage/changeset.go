@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"reflect"
+)
+
+/*
+Changeset describes a batch of row-level changes to apply to a Backend.
+Backends apply a changeset as a whole, either every change is stored or
+none of them are.
+*/
+type Changeset struct {
+	Puts    []Task
+	Deletes []string
+}
+
+/*
+IsEmpty returns true if the changeset doesn't change anything.
+*/
+func (c Changeset) IsEmpty() bool {
+	return len(c.Puts) == 0 && len(c.Deletes) == 0
+}
+
+/*
+diffTasks compares the serialized tasks from before and after a mutation
+and returns the changes needed to get from one to the other.
+*/
+func diffTasks(before map[string]Task, after map[string]Task) Changeset {
+	var changes Changeset
+
+	for id, afterTask := range after {
+		beforeTask, existed := before[id]
+		if !existed || !reflect.DeepEqual(beforeTask, afterTask) {
+			changes.Puts = append(changes.Puts, afterTask)
+		}
+	}
+
+	for id := range before {
+		if _, stillExists := after[id]; !stillExists {
+			changes.Deletes = append(changes.Deletes, id)
+		}
+	}
+
+	return changes
+}
+
+/*
+applyChangeset applies a changeset to a plain slice of tasks, for backends
+with no better way of doing it.
+*/
+func applyChangeset(tasks []Task, changes Changeset) []Task {
+	for _, taskID := range changes.Deletes {
+		index := findTask(tasks, taskID)
+		if index != -1 {
+			tasks = append(tasks[:index], tasks[index+1:]...)
+		}
+	}
+
+	for _, t := range changes.Puts {
+		index := findTask(tasks, t.ID)
+		if index == -1 {
+			tasks = append(tasks, t)
+		} else {
+			tasks[index] = t
+		}
+	}
+
+	return tasks
+}
@@ -0,0 +1,412 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+journalCompactionThreshold is the number of journal entries after which the
+journal is folded into a fresh snapshot of the storage file.
+*/
+const journalCompactionThreshold = 1000
+
+/*
+JSONFile is a Backend which keeps every task in a json snapshot file, along
+with an append-only journal of the changes made since the snapshot was
+written.
+
+Snapshots are written to a temporary file which is synced to disk before
+being renamed over the live file, so a crash mid-write leaves the previous
+snapshot intact. Changes are appended (and synced) to the journal, which is
+replayed on top of the snapshot when loading. Once the journal grows long
+enough it is compacted into a new snapshot.
+*/
+type JSONFile struct {
+	filename        string
+	journalFilename string
+
+	journalEntries int
+
+	/*
+		openJournal opens the journal for appending entries to. Tests
+		swap it out to make writes fail.
+	*/
+	openJournal func(filename string) (journalFile, error)
+}
+
+/*
+journalFile is the journal, opened for appending. It's an *os.File outside
+of tests.
+*/
+type journalFile interface {
+	io.WriteCloser
+	Stat() (os.FileInfo, error)
+	Sync() error
+}
+
+func openJournal(filename string) (journalFile, error) {
+	return os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+}
+
+/*
+journalEntry is a single line of the journal, one per applied changeset.
+Entries are stamped with the schema version they were written in, entries
+from before versioning was introduced have a version of zero.
+*/
+type journalEntry struct {
+	Version int
+	Time    int64
+	Puts    []Task
+	Deletes []string
+}
+
+/*
+NewJSONFile returns a Backend storing tasks in the named file. The journal
+is kept alongside it, in a file with the same name plus ".journal". Both
+files are created the first time tasks are saved.
+*/
+func NewJSONFile(filename string) *JSONFile {
+	return &JSONFile{
+		filename:        filename,
+		journalFilename: filename + ".journal",
+		openJournal:     openJournal,
+	}
+}
+
+/*
+Load reads the snapshot and replays the journal on top of it. A missing
+snapshot is treated as an empty list of tasks.
+
+A snapshot written in an older version of the format is migrated to the
+current one, and the original is kept alongside it in a backup file named
+after its version (".v1.bak").
+
+A crash while appending to the journal can leave a partially written last
+entry. That entry was never acknowledged, so it is discarded (and cut from
+the journal) rather than treated as an error.
+*/
+func (f *JSONFile) Load() ([]Task, error) {
+	tasks, report, err := f.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	if report.NeedsMigration() {
+		if err := f.upgradeSnapshot(tasks, report); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, validLength, err := f.readJournal()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		tasks = applyChangeset(tasks, Changeset{Puts: entry.Puts, Deletes: entry.Deletes})
+	}
+
+	if err := f.truncateJournal(validLength); err != nil {
+		return nil, err
+	}
+
+	f.journalEntries = len(entries)
+
+	return tasks, nil
+}
+
+/*
+PlanMigration reports what loading the file would do to bring it up to the
+current version of the format, without changing anything.
+*/
+func (f *JSONFile) PlanMigration() (MigrationReport, error) {
+	_, report, err := f.loadSnapshot()
+
+	return report, err
+}
+
+/*
+Save atomically replaces the snapshot with the supplied tasks and clears
+the journal.
+*/
+func (f *JSONFile) Save(tasks []Task) error {
+	if err := f.writeSnapshot(tasks); err != nil {
+		return err
+	}
+
+	// Anything in the journal is already part of the new snapshot.
+	if err := f.truncateJournal(0); err != nil {
+		return err
+	}
+
+	f.journalEntries = 0
+
+	return nil
+}
+
+/*
+GetTask reads the file and returns the task with the supplied ID.
+*/
+func (f *JSONFile) GetTask(taskID string) (Task, error) {
+	tasks, err := f.Load()
+	if err != nil {
+		return Task{}, err
+	}
+
+	index := findTask(tasks, taskID)
+	if index == -1 {
+		return Task{}, task.NewNotFoundError(taskID)
+	}
+
+	return tasks[index], nil
+}
+
+/*
+Apply appends the changeset to the journal as a single entry, compacting
+the journal into a new snapshot once it has grown long enough.
+
+If the entry can't be written in full and synced, whatever part of it made
+it into the journal is cut back out. Otherwise the next entry would be
+appended onto the torn one, leaving a journal which can't be loaded, or a
+change the store rolled back would be replayed the next time it's loaded.
+*/
+func (f *JSONFile) Apply(changes Changeset) error {
+	entry, err := json.Marshal(journalEntry{
+		Version: CurrentSchemaVersion,
+		Time:    time.Now().Unix(),
+		Puts:    changes.Puts,
+		Deletes: changes.Deletes,
+	})
+	if err != nil {
+		return err
+	}
+
+	journal, err := f.openJournal(f.journalFilename)
+	if err != nil {
+		return err
+	}
+
+	info, err := journal.Stat()
+	if err != nil {
+		journal.Close()
+		return err
+	}
+
+	_, err = journal.Write(append(entry, '\n'))
+	if err == nil {
+		err = journal.Sync()
+	}
+	if closeErr := journal.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if truncateErr := f.truncateJournal(info.Size()); truncateErr != nil {
+			return fmt.Errorf("%v (and the failed entry couldn't be cut from the journal: %v)", err, truncateErr)
+		}
+		return err
+	}
+
+	f.journalEntries++
+
+	if f.journalEntries >= journalCompactionThreshold {
+		return f.compact()
+	}
+
+	return nil
+}
+
+/*
+PutTask adds or replaces a single task.
+*/
+func (f *JSONFile) PutTask(t Task) error {
+	return f.Apply(Changeset{Puts: []Task{t}})
+}
+
+/*
+DeleteTask removes a single task.
+*/
+func (f *JSONFile) DeleteTask(taskID string) error {
+	return f.Apply(Changeset{Deletes: []string{taskID}})
+}
+
+/*
+compact folds the journal into a new snapshot.
+*/
+func (f *JSONFile) compact() error {
+	tasks, err := f.Load()
+	if err != nil {
+		return err
+	}
+
+	return f.Save(tasks)
+}
+
+func (f *JSONFile) loadSnapshot() ([]Task, MigrationReport, error) {
+	report := MigrationReport{
+		Filename:    f.filename,
+		FromVersion: CurrentSchemaVersion,
+		ToVersion:   CurrentSchemaVersion,
+	}
+
+	contents, err := ioutil.ReadFile(f.filename)
+	if os.IsNotExist(err) {
+		return []Task{}, report, nil
+	} else if err != nil {
+		return nil, report, err
+	}
+
+	tasks, report, err := task.DecodeSnapshot(contents)
+	report.Filename = f.filename
+
+	return tasks, report, err
+}
+
+func (f *JSONFile) writeSnapshot(tasks []Task) error {
+	contents, err := task.EncodeSnapshot(tasks)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomically(f.filename, contents)
+}
+
+/*
+upgradeSnapshot backs up the snapshot as it is, then replaces it with the
+migrated tasks.
+*/
+func (f *JSONFile) upgradeSnapshot(tasks []Task, report MigrationReport) error {
+	original, err := ioutil.ReadFile(f.filename)
+	if err != nil {
+		return err
+	}
+
+	backupFilename := fmt.Sprintf("%v.v%v.bak", f.filename, report.FromVersion)
+	if err := writeFileAtomically(backupFilename, original); err != nil {
+		return err
+	}
+
+	return f.writeSnapshot(tasks)
+}
+
+/*
+readJournal returns every complete entry in the journal, along with the
+length in bytes of the journal up to the end of the last complete entry.
+*/
+func (f *JSONFile) readJournal() ([]journalEntry, int64, error) {
+	journal, err := os.Open(f.journalFilename)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	defer journal.Close()
+
+	var entries []journalEntry
+	var validLength int64
+
+	reader := bufio.NewReader(journal)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// Whatever is left without a trailing newline is a torn write.
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
+
+		var entry journalEntry
+		if err := json.Unmarshal(bytes.TrimSpace(line), &entry); err != nil {
+			return nil, 0, err
+		}
+
+		if entry.Version > CurrentSchemaVersion {
+			return nil, 0, fmt.Errorf("journal entry is version %v, newer than the supported version %v", entry.Version, CurrentSchemaVersion)
+		}
+
+		entries = append(entries, entry)
+		validLength += int64(len(line))
+	}
+
+	return entries, validLength, nil
+}
+
+/*
+truncateJournal cuts the journal down to the supplied length, if it is any
+longer than that.
+*/
+func (f *JSONFile) truncateJournal(length int64) error {
+	info, err := os.Stat(f.journalFilename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Size() <= length {
+		return nil
+	}
+
+	return os.Truncate(f.journalFilename, length)
+}
+
+/*
+writeFileAtomically writes the contents to a temporary file in the same
+directory as filename, syncs it to disk and then renames it over filename.
+Readers (and crashes) see either the old file or the new one, never a
+partially written one.
+*/
+func writeFileAtomically(filename string, contents []byte) error {
+	dir, base := filepath.Split(filename)
+	if dir == "" {
+		dir = "."
+	}
+
+	temp, err := ioutil.TempFile(dir, base+".tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = temp.Write(contents)
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	// Sync the directory too, so the rename itself survives a crash. Not
+	// every platform supports this, so failures are ignored.
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+
+	return nil
+}
+
+func findTask(tasks []Task, taskID string) int {
+	for i, t := range tasks {
+		if t.ID == taskID {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+)
+
+/*
+DefaultListName is the name of the tasklist used when no list is named.
+*/
+const DefaultListName = "default"
+
+/*
+ErrInvalidListName is returned when asked for a list whose name isn't
+allowed. List names end up in filenames, so they are restricted to
+letters, digits, dashes and underscores.
+*/
+var ErrInvalidListName = errors.New("Invalid list name")
+
+var validListName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+/*
+Lists is a set of independent, named tasklists. Each list has a Store (and
+so a lock) of its own, an update to one list never waits on another.
+*/
+type Lists struct {
+	lock sync.Mutex
+
+	openStore func(listName string) (*Store, error)
+	stores    map[string]*Store
+}
+
+/*
+NewLists returns an empty set of lists. Lists are opened the first time
+they're asked for, using openStore.
+*/
+func NewLists(openStore func(listName string) (*Store, error)) *Lists {
+	return &Lists{
+		openStore: openStore,
+		stores:    make(map[string]*Store),
+	}
+}
+
+/*
+Get returns the Store for the named list, opening it if this is the first
+time it has been asked for.
+*/
+func (l *Lists) Get(listName string) (*Store, error) {
+	if !validListName.MatchString(listName) {
+		return nil, ErrInvalidListName
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if store, ok := l.stores[listName]; ok {
+		return store, nil
+	}
+
+	store, err := l.openStore(listName)
+	if err != nil {
+		return nil, err
+	}
+
+	l.stores[listName] = store
+
+	return store, nil
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+Memory is a Backend which only keeps tasks in memory. Nothing survives a
+restart, which makes it mostly useful for tests.
+*/
+type Memory struct {
+	tasks []Task
+}
+
+/*
+NewMemory returns an empty in-memory Backend.
+*/
+func NewMemory() *Memory {
+	return &Memory{
+		tasks: []Task{},
+	}
+}
+
+/*
+Load returns a copy of every task held in memory.
+*/
+func (m *Memory) Load() ([]Task, error) {
+	tasks := make([]Task, len(m.tasks))
+	copy(tasks, m.tasks)
+
+	return tasks, nil
+}
+
+/*
+Save replaces the tasks held in memory.
+*/
+func (m *Memory) Save(tasks []Task) error {
+	m.tasks = make([]Task, len(tasks))
+	copy(m.tasks, tasks)
+
+	return nil
+}
+
+/*
+GetTask returns the task with the supplied ID.
+*/
+func (m *Memory) GetTask(taskID string) (Task, error) {
+	index := findTask(m.tasks, taskID)
+	if index == -1 {
+		return Task{}, task.NewNotFoundError(taskID)
+	}
+
+	return m.tasks[index], nil
+}
+
+/*
+Apply applies every change in the changeset.
+*/
+func (m *Memory) Apply(changes Changeset) error {
+	m.tasks = applyChangeset(m.tasks, changes)
+
+	return nil
+}
+
+/*
+PutTask adds or replaces a single task.
+*/
+func (m *Memory) PutTask(t Task) error {
+	return m.Apply(Changeset{Puts: []Task{t}})
+}
+
+/*
+DeleteTask removes a single task.
+*/
+func (m *Memory) DeleteTask(taskID string) error {
+	return m.Apply(Changeset{Deletes: []string{taskID}})
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+CurrentSchemaVersion is the version of the storage file format written by
+this version of the code. Storage files are task snapshots, see
+task.CurrentSchemaVersion for the versions of the format.
+*/
+const CurrentSchemaVersion = task.CurrentSchemaVersion
+
+/*
+MigrationReport describes what was (or in a dry run, would be) done to
+bring a storage file up to date.
+*/
+type MigrationReport = task.MigrationReport
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/jeffbmartinez/todo-persistence/fulltext"
+)
+
+/*
+ErrSearchDisabled is returned by a Store which doesn't keep a search index.
+*/
+var ErrSearchDisabled = errors.New("Search is not enabled")
+
+/*
+KeepSearchIndex has the store keep a full-text index of its tasks, built
+from the tasks loaded from the backend and kept up to date as they change.
+It should be called before the store is used.
+*/
+func (s *Store) KeepSearchIndex() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.index = fulltext.NewIndex()
+	for _, t := range s.persisted {
+		s.index.Put(t.ID, t.Name, t.Notes)
+	}
+}
+
+/*
+Search finds the tasks whose name or notes contain every word of the query,
+best matches first. See fulltext.Index.Search().
+*/
+func (s *Store) Search(query string) ([]fulltext.Result, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.index == nil {
+		return nil, ErrSearchDisabled
+	}
+
+	return s.index.Search(query), nil
+}
+
+func updateIndex(index *fulltext.Index, changes Changeset) {
+	for _, put := range changes.Puts {
+		index.Put(put.ID, put.Name, put.Notes)
+	}
+
+	for _, taskID := range changes.Deletes {
+		index.Delete(taskID)
+	}
+}
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+ErrSnapshotNotFound is returned when asked for a snapshot which doesn't
+exist, or for the state of the tasklist at a time before the oldest kept
+snapshot.
+*/
+var ErrSnapshotNotFound = errors.New("Snapshot not found")
+
+/*
+ErrSnapshotsDisabled is returned by a Store which doesn't keep snapshots.
+*/
+var ErrSnapshotsDisabled = errors.New("Snapshots are not enabled")
+
+const snapshotIDFormat = "20060102T150405.000000000Z"
+const snapshotSuffix = ".json"
+
+/*
+SnapshotPolicy controls how often snapshots of a tasklist are taken, and for
+how long they're kept.
+*/
+type SnapshotPolicy struct {
+	/*
+		Interval is the least amount of time between two snapshots taken
+		automatically as the tasklist changes. A snapshot is always taken
+		before tasks are deleted, regardless of the interval.
+	*/
+	Interval time.Duration
+
+	/*
+		MaxCount is the most snapshots kept, the oldest are removed first.
+		Zero means there's no limit.
+	*/
+	MaxCount int
+
+	/*
+		MaxAge is how long snapshots are kept for. Zero means forever.
+	*/
+	MaxAge time.Duration
+}
+
+/*
+SnapshotInfo describes a single snapshot.
+*/
+type SnapshotInfo struct {
+	ID        string `json:"id"`
+	Time      int64  `json:"time"`
+	TaskCount int    `json:"taskCount"`
+}
+
+/*
+Snapshots keeps a rotating set of timestamped copies of a tasklist in a
+directory, one file per snapshot. Snapshot files use the same format as the
+json storage file.
+*/
+type Snapshots struct {
+	dir    string
+	policy SnapshotPolicy
+
+	lastTaken time.Time
+}
+
+/*
+NewSnapshots returns a set of snapshots kept in dir according to the policy.
+The directory is created when the first snapshot is taken.
+*/
+func NewSnapshots(dir string, policy SnapshotPolicy) *Snapshots {
+	return &Snapshots{
+		dir:    dir,
+		policy: policy,
+	}
+}
+
+/*
+isDue returns true if the policy's interval has passed since the last
+snapshot was taken. Nil snapshots are never due.
+*/
+func (s *Snapshots) isDue(now time.Time) bool {
+	return s != nil && now.Sub(s.lastTaken) >= s.policy.Interval
+}
+
+/*
+Take writes a new snapshot of the tasks and then removes any snapshots the
+policy says are no longer worth keeping.
+*/
+func (s *Snapshots) Take(tasks []Task) (SnapshotInfo, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	now := time.Now().UTC()
+	id := now.Format(snapshotIDFormat)
+
+	contents, err := task.EncodeSnapshot(tasks)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	if err := writeFileAtomically(s.filename(id), contents); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	s.lastTaken = now
+
+	if err := s.prune(now); err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	return SnapshotInfo{
+		ID:        id,
+		Time:      now.Unix(),
+		TaskCount: len(tasks),
+	}, nil
+}
+
+/*
+List describes every kept snapshot, oldest first.
+*/
+func (s *Snapshots) List() ([]SnapshotInfo, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]SnapshotInfo, 0, len(ids))
+	for _, id := range ids {
+		tasks, err := s.Load(id)
+		if err == ErrSnapshotNotFound {
+			// Pruned since the directory was read.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		timestamp, _ := time.Parse(snapshotIDFormat, id)
+
+		infos = append(infos, SnapshotInfo{
+			ID:        id,
+			Time:      timestamp.Unix(),
+			TaskCount: len(tasks),
+		})
+	}
+
+	return infos, nil
+}
+
+/*
+Load reads the tasks from a single snapshot.
+*/
+func (s *Snapshots) Load(id string) ([]Task, error) {
+	if _, err := time.Parse(snapshotIDFormat, id); err != nil {
+		return nil, ErrSnapshotNotFound
+	}
+
+	contents, err := ioutil.ReadFile(s.filename(id))
+	if os.IsNotExist(err) {
+		return nil, ErrSnapshotNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	tasks, _, err := task.DecodeSnapshot(contents)
+
+	return tasks, err
+}
+
+/*
+AsOf returns the ID of the newest snapshot taken at or before the time.
+*/
+func (s *Snapshots) AsOf(when time.Time) (string, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(ids) - 1; i >= 0; i-- {
+		timestamp, _ := time.Parse(snapshotIDFormat, ids[i])
+		if !timestamp.After(when) {
+			return ids[i], nil
+		}
+	}
+
+	return "", ErrSnapshotNotFound
+}
+
+/*
+prune removes the snapshots which are too old, or too many, to keep.
+*/
+func (s *Snapshots) prune(now time.Time) error {
+	ids, err := s.ids()
+	if err != nil {
+		return err
+	}
+
+	for i, id := range ids {
+		tooMany := s.policy.MaxCount > 0 && len(ids)-i > s.policy.MaxCount
+
+		timestamp, _ := time.Parse(snapshotIDFormat, id)
+		tooOld := s.policy.MaxAge > 0 && now.Sub(timestamp) > s.policy.MaxAge
+
+		if !tooMany && !tooOld {
+			// Everything after this one is newer.
+			break
+		}
+
+		if err := os.Remove(s.filename(id)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+ids returns the IDs of every snapshot in the directory, oldest first. The ID
+format sorts chronologically as a plain string.
+*/
+func (s *Snapshots) ids() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, file := range files {
+		id := strings.TrimSuffix(file.Name(), snapshotSuffix)
+		if id == file.Name() {
+			continue
+		}
+
+		if _, err := time.Parse(snapshotIDFormat, id); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (s *Snapshots) filename(id string) string {
+	return filepath.Join(s.dir, id+snapshotSuffix)
+}
+
+/*
+sortedTasks returns the tasks in a map in the order task.Tasklist.Records()
+would give them.
+*/
+func sortedTasks(tasks map[string]Task) []Task {
+	sorted := make([]Task, 0, len(tasks))
+	for _, t := range tasks {
+		sorted = append(sorted, t)
+	}
+
+	task.SortRecords(sorted)
+
+	return sorted
+}
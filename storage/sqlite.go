@@ -0,0 +1,563 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+
+	_ "github.com/mattn/go-sqlite3" // Registers the "sqlite3" database/sql driver
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+sqliteMigration is a single change to the database schema.
+*/
+type sqliteMigration struct {
+	description string
+	statements  string
+}
+
+/*
+sqliteMigrations brings the database schema up to date. The database's
+user_version pragma records how many of these have been applied, so new
+schema changes must only ever be appended to the end of the list.
+*/
+var sqliteMigrations = []sqliteMigration{
+	{
+		description: "Create the tasks, subtasks, categories and task_categories tables",
+		statements: `CREATE TABLE tasks (
+			id            TEXT PRIMARY KEY,
+			name          TEXT NOT NULL,
+			complete      INTEGER NOT NULL,
+			created_date  INTEGER NOT NULL,
+			modified_date INTEGER NOT NULL,
+			due_date      INTEGER NOT NULL
+		);
+
+		CREATE TABLE subtasks (
+			parent_id  TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+			subtask_id TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+			position   INTEGER NOT NULL,
+			PRIMARY KEY (parent_id, subtask_id)
+		);
+
+		CREATE INDEX subtasks_subtask_id ON subtasks(subtask_id);
+
+		CREATE TABLE categories (
+			id   INTEGER PRIMARY KEY,
+			name TEXT NOT NULL UNIQUE
+		);
+
+		CREATE TABLE task_categories (
+			task_id     TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+			category_id INTEGER NOT NULL REFERENCES categories(id),
+			position    INTEGER NOT NULL,
+			PRIMARY KEY (task_id, category_id)
+		);`,
+	},
+	{
+		description: "Add a revision number to tasks",
+		statements:  `ALTER TABLE tasks ADD COLUMN revision INTEGER NOT NULL DEFAULT 0;`,
+	},
+	{
+		description: "Add notes to tasks",
+		statements:  `ALTER TABLE tasks ADD COLUMN notes TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		description: "Add a priority to tasks",
+		statements:  `ALTER TABLE tasks ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;`,
+	},
+	{
+		description: "Add recurrence rules and series to tasks",
+		statements: `ALTER TABLE tasks ADD COLUMN recurrence TEXT NOT NULL DEFAULT '';
+		ALTER TABLE tasks ADD COLUMN series_id TEXT NOT NULL DEFAULT '';
+		ALTER TABLE tasks ADD COLUMN occurrence INTEGER NOT NULL DEFAULT 0;`,
+	},
+	{
+		description: "Create the dependencies table",
+		statements: `CREATE TABLE dependencies (
+			task_id    TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+			blocker_id TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+			position   INTEGER NOT NULL,
+			PRIMARY KEY (task_id, blocker_id)
+		);
+
+		CREATE INDEX dependencies_blocker_id ON dependencies(blocker_id);`,
+	},
+	{
+		description: "Add estimates to tasks",
+		statements:  `ALTER TABLE tasks ADD COLUMN estimate INTEGER NOT NULL DEFAULT 0;`,
+	},
+	{
+		description: "Create the time entries table",
+		statements: `CREATE TABLE time_entries (
+			task_id    TEXT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE DEFERRABLE INITIALLY DEFERRED,
+			position   INTEGER NOT NULL,
+			start_date INTEGER NOT NULL,
+			end_date   INTEGER NOT NULL,
+			PRIMARY KEY (task_id, position)
+		);`,
+	},
+}
+
+/*
+SQLite is a Backend which keeps tasks in an embedded SQLite database. Tasks,
+the parent/subtask edges and dependencies between them, time entries and
+categories each get a table of their own, so single tasks can be read and
+written without touching the rest of the tasklist.
+*/
+type SQLite struct {
+	db *sql.DB
+}
+
+/*
+NewSQLite opens (creating it if needed) the SQLite database in the named
+file and brings its schema up to date.
+*/
+func NewSQLite(filename string) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", filename+"?_foreign_keys=1")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time anyway.
+	db.SetMaxOpenConns(1)
+
+	s := &SQLite{db: db}
+
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+/*
+Close closes the underlying database.
+*/
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) migrate() error {
+	version, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for version < len(sqliteMigrations) {
+		err := s.inTransaction(func(tx *sql.Tx) error {
+			if _, err := tx.Exec(sqliteMigrations[version].statements); err != nil {
+				return err
+			}
+
+			// Pragmas don't accept bound parameters.
+			_, err := tx.Exec("PRAGMA user_version = " + strconv.Itoa(version+1))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		version++
+	}
+
+	return nil
+}
+
+func (s *SQLite) schemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&version)
+
+	return version, err
+}
+
+/*
+PlanSQLiteMigration reports which schema changes opening the named database
+would apply, without changing (or creating) anything.
+*/
+func PlanSQLiteMigration(filename string) (MigrationReport, error) {
+	report := MigrationReport{
+		Filename:    filename,
+		FromVersion: len(sqliteMigrations),
+		ToVersion:   len(sqliteMigrations),
+	}
+
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return report, nil
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+filename+"?mode=ro")
+	if err != nil {
+		return report, err
+	}
+	defer db.Close()
+
+	s := &SQLite{db: db}
+
+	report.FromVersion, err = s.schemaVersion()
+	if err != nil {
+		return report, err
+	}
+
+	if report.FromVersion > report.ToVersion {
+		return report, fmt.Errorf("database schema is version %v, newer than the supported version %v", report.FromVersion, report.ToVersion)
+	}
+
+	for _, migration := range sqliteMigrations[report.FromVersion:] {
+		report.AddChange(migration.description)
+	}
+
+	return report, nil
+}
+
+/*
+Load reads every task from the database.
+*/
+func (s *SQLite) Load() ([]Task, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, complete, revision, notes, priority, created_date, modified_date, due_date, estimate, recurrence, series_id, occurrence
+		FROM tasks
+		ORDER BY created_date, id`)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := []Task{}
+	indexes := make(map[string]int)
+
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		indexes[t.ID] = len(tasks)
+		tasks = append(tasks, t)
+	}
+	rows.Close()
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = s.eachRow(`SELECT parent_id, subtask_id FROM subtasks ORDER BY parent_id, position`, func(parentID string, subtaskID string) {
+		tasks[indexes[parentID]].SubtaskIDs = append(tasks[indexes[parentID]].SubtaskIDs, subtaskID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.eachRow(`SELECT parent_id, subtask_id FROM subtasks ORDER BY rowid`, func(parentID string, subtaskID string) {
+		tasks[indexes[subtaskID]].ParentIDs = append(tasks[indexes[subtaskID]].ParentIDs, parentID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.eachRow(`
+		SELECT task_categories.task_id, categories.name
+		FROM task_categories JOIN categories ON categories.id = task_categories.category_id
+		ORDER BY task_categories.task_id, task_categories.position`, func(taskID string, category string) {
+		tasks[indexes[taskID]].Categories = append(tasks[indexes[taskID]].Categories, category)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.eachRow(`SELECT task_id, blocker_id FROM dependencies ORDER BY task_id, position`, func(taskID string, blockerID string) {
+		tasks[indexes[taskID]].BlockedByIDs = append(tasks[indexes[taskID]].BlockedByIDs, blockerID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.eachTimeEntry(`SELECT task_id, start_date, end_date FROM time_entries ORDER BY task_id, position`, func(taskID string, entry task.TimeEntry) {
+		tasks[indexes[taskID]].TimeEntries = append(tasks[indexes[taskID]].TimeEntries, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tasks, nil
+}
+
+/*
+Save replaces the contents of the database with the supplied tasks.
+*/
+func (s *SQLite) Save(tasks []Task) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		for _, table := range []string{"time_entries", "dependencies", "task_categories", "subtasks", "tasks"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return err
+			}
+		}
+
+		for _, t := range tasks {
+			if err := putTask(tx, t); err != nil {
+				return err
+			}
+		}
+
+		return deleteUnusedCategories(tx)
+	})
+}
+
+/*
+GetTask reads a single task, along with its edges, categories and time
+entries, from the database.
+*/
+func (s *SQLite) GetTask(taskID string) (Task, error) {
+	row := s.db.QueryRow(`
+		SELECT id, name, complete, revision, notes, priority, created_date, modified_date, due_date, estimate, recurrence, series_id, occurrence
+		FROM tasks
+		WHERE id = ?`, taskID)
+
+	t, err := scanTask(row)
+	if err == sql.ErrNoRows {
+		return Task{}, task.NewNotFoundError(taskID)
+	} else if err != nil {
+		return Task{}, err
+	}
+
+	err = s.eachRow(`SELECT subtask_id, '' FROM subtasks WHERE parent_id = ? ORDER BY position`, func(subtaskID string, _ string) {
+		t.SubtaskIDs = append(t.SubtaskIDs, subtaskID)
+	}, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	err = s.eachRow(`SELECT parent_id, '' FROM subtasks WHERE subtask_id = ? ORDER BY rowid`, func(parentID string, _ string) {
+		t.ParentIDs = append(t.ParentIDs, parentID)
+	}, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	err = s.eachRow(`
+		SELECT categories.name, ''
+		FROM task_categories JOIN categories ON categories.id = task_categories.category_id
+		WHERE task_categories.task_id = ?
+		ORDER BY task_categories.position`, func(category string, _ string) {
+		t.Categories = append(t.Categories, category)
+	}, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	err = s.eachRow(`SELECT blocker_id, '' FROM dependencies WHERE task_id = ? ORDER BY position`, func(blockerID string, _ string) {
+		t.BlockedByIDs = append(t.BlockedByIDs, blockerID)
+	}, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	err = s.eachTimeEntry(`SELECT task_id, start_date, end_date FROM time_entries WHERE task_id = ? ORDER BY position`, func(_ string, entry task.TimeEntry) {
+		t.TimeEntries = append(t.TimeEntries, entry)
+	}, taskID)
+	if err != nil {
+		return Task{}, err
+	}
+
+	return t, nil
+}
+
+/*
+Apply applies the changeset within a single transaction.
+*/
+func (s *SQLite) Apply(changes Changeset) error {
+	return s.inTransaction(func(tx *sql.Tx) error {
+		for _, taskID := range changes.Deletes {
+			if _, err := tx.Exec(`DELETE FROM tasks WHERE id = ?`, taskID); err != nil {
+				return err
+			}
+		}
+
+		for _, t := range changes.Puts {
+			if err := putTask(tx, t); err != nil {
+				return err
+			}
+		}
+
+		return deleteUnusedCategories(tx)
+	})
+}
+
+/*
+PutTask adds or replaces a single task.
+*/
+func (s *SQLite) PutTask(t Task) error {
+	return s.Apply(Changeset{Puts: []Task{t}})
+}
+
+/*
+DeleteTask removes a single task.
+*/
+func (s *SQLite) DeleteTask(taskID string) error {
+	return s.Apply(Changeset{Deletes: []string{taskID}})
+}
+
+func (s *SQLite) inTransaction(work func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := work(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+/*
+eachRow runs a query returning two string columns and calls handleRow for
+every row in the result.
+*/
+func (s *SQLite) eachRow(query string, handleRow func(first string, second string), args ...interface{}) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var first, second string
+		if err := rows.Scan(&first, &second); err != nil {
+			return err
+		}
+
+		handleRow(first, second)
+	}
+
+	return rows.Err()
+}
+
+/*
+eachTimeEntry runs a query returning a task ID along with the start and end
+of one of its time entries, and calls handleRow for every row in the
+result.
+*/
+func (s *SQLite) eachTimeEntry(query string, handleRow func(taskID string, entry task.TimeEntry), args ...interface{}) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var taskID string
+		var entry task.TimeEntry
+		if err := rows.Scan(&taskID, &entry.Start, &entry.End); err != nil {
+			return err
+		}
+
+		handleRow(taskID, entry)
+	}
+
+	return rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTask(row scanner) (Task, error) {
+	var t Task
+	err := row.Scan(&t.ID, &t.Name, &t.Complete, &t.Revision, &t.Notes, &t.Priority, &t.CreatedDate, &t.ModifiedDate, &t.DueDate, &t.Estimate, &t.Recurrence, &t.SeriesID, &t.Occurrence)
+
+	t.Categories = []string{}
+
+	return t, err
+}
+
+/*
+putTask upserts a task row and replaces the task's subtask edges,
+dependencies, time entries and categories. Edges are owned by the parent task, the
+subtask side of an edge is written when the parent is. Likewise
+dependencies are owned by the task waiting on the blocker.
+*/
+func putTask(tx *sql.Tx, t Task) error {
+	_, err := tx.Exec(`
+		INSERT INTO tasks (id, name, complete, revision, notes, priority, created_date, modified_date, due_date, estimate, recurrence, series_id, occurrence)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			name = excluded.name,
+			complete = excluded.complete,
+			revision = excluded.revision,
+			notes = excluded.notes,
+			priority = excluded.priority,
+			created_date = excluded.created_date,
+			modified_date = excluded.modified_date,
+			due_date = excluded.due_date,
+			estimate = excluded.estimate,
+			recurrence = excluded.recurrence,
+			series_id = excluded.series_id,
+			occurrence = excluded.occurrence`,
+		t.ID, t.Name, t.Complete, t.Revision, t.Notes, t.Priority, t.CreatedDate, t.ModifiedDate, t.DueDate, t.Estimate, t.Recurrence, t.SeriesID, t.Occurrence)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM subtasks WHERE parent_id = ?`, t.ID); err != nil {
+		return err
+	}
+
+	for position, subtaskID := range t.SubtaskIDs {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO subtasks (parent_id, subtask_id, position) VALUES (?, ?, ?)`, t.ID, subtaskID, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM dependencies WHERE task_id = ?`, t.ID); err != nil {
+		return err
+	}
+
+	for position, blockerID := range t.BlockedByIDs {
+		_, err := tx.Exec(`INSERT OR IGNORE INTO dependencies (task_id, blocker_id, position) VALUES (?, ?, ?)`, t.ID, blockerID, position)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM time_entries WHERE task_id = ?`, t.ID); err != nil {
+		return err
+	}
+
+	for position, entry := range t.TimeEntries {
+		_, err := tx.Exec(`INSERT INTO time_entries (task_id, position, start_date, end_date) VALUES (?, ?, ?, ?)`, t.ID, position, entry.Start, entry.End)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`DELETE FROM task_categories WHERE task_id = ?`, t.ID); err != nil {
+		return err
+	}
+
+	for position, category := range t.Categories {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO categories (name) VALUES (?)`, category); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(`
+			INSERT OR IGNORE INTO task_categories (task_id, category_id, position)
+			SELECT ?, id, ? FROM categories WHERE name = ?`, t.ID, position, category)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deleteUnusedCategories(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM categories WHERE id NOT IN (SELECT category_id FROM task_categories)`)
+	return err
+}
@@ -0,0 +1,747 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+func testBackend(t *testing.T, b Backend) {
+	tasks, err := b.Load()
+	if err != nil {
+		t.Fatalf("Couldn't load from empty backend (%v)", err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("Empty backend should have no tasks, has %v", len(tasks))
+	}
+
+	parent := Task{ID: "parent", Name: "parent", SubtaskIDs: []string{"child"}}
+	child := Task{ID: "child", Name: "child", ParentIDs: []string{"parent"}}
+
+	if err := b.Save([]Task{parent, child}); err != nil {
+		t.Fatalf("Couldn't save tasks (%v)", err)
+	}
+
+	child.Name = "renamed"
+	child.TimeEntries = []task.TimeEntry{{Start: 10, End: 20}, {Start: 30}}
+	if err := b.PutTask(child); err != nil {
+		t.Fatalf("Couldn't put task (%v)", err)
+	}
+
+	stored, err := b.GetTask("child")
+	if err != nil {
+		t.Fatalf("Couldn't get task (%v)", err)
+	}
+	if stored.Name != "renamed" {
+		t.Fatalf("Expected renamed task, got '%v'", stored.Name)
+	}
+	if !reflect.DeepEqual(stored.TimeEntries, child.TimeEntries) {
+		t.Fatalf("Expected time entries %v, got %v", child.TimeEntries, stored.TimeEntries)
+	}
+
+	if err := b.DeleteTask("parent"); err != nil {
+		t.Fatalf("Couldn't delete task (%v)", err)
+	}
+
+	if _, err := b.GetTask("parent"); err == nil {
+		t.Fatal("Deleted task should not be found")
+	} else if _, ok := err.(task.NotFoundError); !ok {
+		t.Fatalf("Expected a NotFoundError, got %v", err)
+	}
+
+	tasks, err = b.Load()
+	if err != nil {
+		t.Fatalf("Couldn't load tasks (%v)", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != "child" {
+		t.Fatalf("Expected only the child task to remain, got %v", tasks)
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackend(t, NewMemory())
+}
+
+func TestJSONFileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	testBackend(t, NewJSONFile(filepath.Join(dir, "tasks.json")))
+}
+
+func TestOpenRebuildsGraph(t *testing.T) {
+	b := NewMemory()
+
+	tasklist := task.NewTasklist()
+	root := tasklist.AddTask("root", nil)
+	tasklist.AddTask("child", []*task.Task{root})
+
+	if err := b.Save(tasklist.Records()); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.View(func(restored *task.Tasklist) error {
+		if len(restored.Registry) != 2 || len(restored.RootTasks) != 1 {
+			t.Fatalf("Expected 2 tasks and 1 root, got %v and %v", len(restored.Registry), len(restored.RootTasks))
+		}
+
+		restoredRoot := restored.RootTasks[0]
+		if restoredRoot.ID != root.ID || len(restoredRoot.Subtasks) != 1 {
+			t.Fatal("Root task should have been restored along with its subtask")
+		}
+		if restoredRoot.Subtasks[0].Parents[0] != restoredRoot {
+			t.Fatal("Subtask should point back to its restored parent")
+		}
+
+		return nil
+	})
+}
+
+func TestSQLiteBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := NewSQLite(filepath.Join(dir, "tasks.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	testBackend(t, b)
+}
+
+func TestStoreUpdateOnlyStoresChanges(t *testing.T) {
+	b := NewMemory()
+	store, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rootID string
+	err = store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		root := tasklist.AddTask("root", nil)
+		tasklist.AddTask("child", []*task.Task{root})
+		rootID = root.ID
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, _ := b.Load()
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 stored tasks, got %v", len(tasks))
+	}
+
+	err = store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		tasklist.Delete(tasklist.Registry[rootID])
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, _ = b.Load()
+	if len(tasks) != 0 {
+		t.Fatalf("Deleting the root should delete its subtask too, %v tasks left", len(tasks))
+	}
+}
+
+func TestStoreUpdateRollsBackOnError(t *testing.T) {
+	store, err := Open(NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rootID string
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		rootID = tasklist.AddTask("root", nil).ID
+		return nil
+	})
+
+	failure := errors.New("failure")
+	err = store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		root, _ := tasklist.Get(rootID)
+		root.Name = "renamed"
+		tasklist.AddTask("another", nil)
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("Expected the update's error to be returned, got %v", err)
+	}
+
+	store.View(func(tasklist *task.Tasklist) error {
+		if len(tasklist.Registry) != 1 || tasklist.Registry[rootID].Name != "root" {
+			t.Fatal("Failed update should have been rolled back")
+		}
+		return nil
+	})
+}
+
+func TestStoreUpdateLooksAroundTouchedTasks(t *testing.T) {
+	b := NewMemory()
+	store, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var root, child, other *task.Task
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		root = tasklist.AddTask("root", nil)
+		child = tasklist.AddTask("child", []*task.Task{root})
+		other = tasklist.AddTask("other", nil)
+		return nil
+	})
+
+	// Failing without changing anything leaves the tasklist as it is,
+	// rather than rebuilding it.
+	failure := errors.New("failure")
+	err = store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		tasklist.Get(child.ID)
+		return failure
+	})
+	if err != failure {
+		t.Fatalf("Expected the update's error to be returned, got %v", err)
+	}
+
+	store.View(func(tasklist *task.Tasklist) error {
+		if tasklist.Registry[child.ID] != child {
+			t.Fatal("An update which changed nothing shouldn't have been rolled back")
+		}
+		return nil
+	})
+
+	// Completing the child completes the root along with it, which has to
+	// be stored even though only the child was touched.
+	err = store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		child, _ := tasklist.Get(child.ID)
+		child.MarkAsComplete()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, _ := b.Load()
+	for _, stored := range tasks {
+		switch stored.ID {
+		case root.ID, child.ID:
+			if !stored.Complete || stored.Revision != 2 {
+				t.Errorf("Expected %v to be stored complete at revision 2, got %+v", stored.Name, stored)
+			}
+		case other.ID:
+			if stored.Complete || stored.Revision != 1 {
+				t.Errorf("Expected other to be left alone, got %+v", stored)
+			}
+		}
+	}
+}
+
+func TestJSONFileReplaysJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "tasks.json")
+
+	b := NewJSONFile(filename)
+	if err := b.Save([]Task{{ID: "first", Name: "first"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := Changeset{Puts: []Task{{ID: "second", Name: "second"}}, Deletes: []string{"first"}}
+	if err := b.Apply(changes); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash part way through appending another entry.
+	journal, err := os.OpenFile(filename+".journal", os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal.Write([]byte(`{"Time":0,"Puts":[{"ID":"thi`))
+	journal.Close()
+
+	tasks, err := NewJSONFile(filename).Load()
+	if err != nil {
+		t.Fatalf("Torn journal entry should be ignored (%v)", err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != "second" {
+		t.Fatalf("Expected the journal to be replayed on the snapshot, got %v", tasks)
+	}
+
+	snapshot, _, err := NewJSONFile(filename).loadSnapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshot) != 1 || snapshot[0].ID != "first" {
+		t.Fatalf("Snapshot should be untouched until compaction, got %v", snapshot)
+	}
+}
+
+/*
+shortWriteJournal is a journal which only writes the first half of what
+it's given, as if the disk filled up.
+*/
+type shortWriteJournal struct {
+	journalFile
+}
+
+func (j shortWriteJournal) Write(contents []byte) (int, error) {
+	written, _ := j.journalFile.Write(contents[:len(contents)/2])
+	return written, errors.New("no space left on device")
+}
+
+func TestJSONFileCutsFailedJournalWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "tasks.json")
+
+	b := NewJSONFile(filename)
+	if err := b.Apply(Changeset{Puts: []Task{{ID: "first", Name: "first"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	b.openJournal = func(filename string) (journalFile, error) {
+		journal, err := openJournal(filename)
+		return shortWriteJournal{journal}, err
+	}
+	if err := b.Apply(Changeset{Puts: []Task{{ID: "failed", Name: "failed"}}}); err == nil {
+		t.Fatal("Expected the short write to fail the apply")
+	}
+
+	b.openJournal = openJournal
+	if err := b.Apply(Changeset{Puts: []Task{{ID: "third", Name: "third"}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := NewJSONFile(filename).Load()
+	if err != nil {
+		t.Fatalf("Journal should load after a failed write (%v)", err)
+	}
+	if len(tasks) != 2 || findTask(tasks, "first") == -1 || findTask(tasks, "third") == -1 {
+		t.Fatalf("Expected the first and third tasks, but not the failed one, got %v", tasks)
+	}
+}
+
+func TestListsAreIndependent(t *testing.T) {
+	lists := NewLists(func(listName string) (*Store, error) {
+		return Open(NewMemory())
+	})
+
+	work, err := lists.Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	home, err := lists.Get("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if work == home {
+		t.Fatal("Differently named lists should have different stores")
+	}
+
+	if again, _ := lists.Get("work"); again != work {
+		t.Fatal("Asking for the same list twice should return the same store")
+	}
+
+	if _, err := lists.Get("../work"); err != ErrInvalidListName {
+		t.Fatalf("Expected an invalid list name error, got %v", err)
+	}
+}
+
+func TestTasklistFilesAndJSONFileShareFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tasklist := task.NewTasklist()
+	top := tasklist.AddTask("top", nil)
+	left := tasklist.AddTask("left", []*task.Task{top})
+	right := tasklist.AddTask("right", []*task.Task{top})
+	shared := tasklist.AddTask("shared", []*task.Task{left, right})
+	shared.AddBlocker(left)
+	tasklist.AddTask("alone", nil)
+
+	// Stored by the tasklist, loaded by the backend.
+	stored := filepath.Join(dir, "stored.json")
+	if err := tasklist.Store(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewJSONFile(stored)
+	if report, err := b.PlanMigration(); err != nil || report.NeedsMigration() {
+		t.Fatalf("A stored tasklist should already be in the current format, got %+v (%v)", report, err)
+	}
+
+	records, err := b.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records, tasklist.Records()) {
+		t.Fatalf("Expected the backend to load the stored graph, got %+v", records)
+	}
+	if _, err := os.Stat(stored + ".v1.bak"); !os.IsNotExist(err) {
+		t.Fatal("Loading a stored tasklist shouldn't leave a backup behind")
+	}
+
+	// Saved by the backend, restored by the tasklist.
+	saved := filepath.Join(dir, "saved.json")
+	if err := NewJSONFile(saved).Save(tasklist.Records()); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := task.NewTasklist()
+	if err := restored.Restore(saved); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored.Records(), tasklist.Records()) || len(restored.RootTasks) != 2 {
+		t.Fatalf("Expected the tasklist to restore the saved graph, got %+v", restored.Records())
+	}
+}
+
+func TestMigrateLegacyFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	legacy, err := ioutil.ReadFile(filepath.Join("testdata", "restore1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(dir, "tasks.json")
+	if err := ioutil.WriteFile(filename, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	b := NewJSONFile(filename)
+
+	report, err := b.PlanMigration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.FromVersion != 0 || report.ToVersion != CurrentSchemaVersion || len(report.Changes) == 0 {
+		t.Fatalf("Unexpected migration report %+v", report)
+	}
+
+	if contents, _ := ioutil.ReadFile(filename); string(contents) != string(legacy) {
+		t.Fatal("Planning a migration should not change the file")
+	}
+
+	store, err := Open(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store.View(func(tasklist *task.Tasklist) error {
+		if len(tasklist.Registry) != 6 || len(tasklist.RootTasks) != 3 {
+			t.Fatalf("Expected 6 tasks with 3 roots, got %v and %v", len(tasklist.Registry), len(tasklist.RootTasks))
+		}
+
+		twoOne := tasklist.Registry["1cdf01c0-19f9-46b7-a4dc-750ec8988305"]
+		if len(twoOne.Parents) != 1 || twoOne.Parents[0].Name != "two" || len(twoOne.Subtasks) != 1 {
+			t.Fatal("Edges should be taken from the legacy subtask sets")
+		}
+
+		return nil
+	})
+
+	if report, _ := b.PlanMigration(); report.NeedsMigration() {
+		t.Fatal("Loading should have left the file migrated")
+	}
+
+	if _, err := os.Stat(filename + ".v0.bak"); err != nil {
+		t.Fatalf("Original file should have been backed up (%v)", err)
+	}
+}
+
+func TestRestoreDeletedTasksFromSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := Open(NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.KeepSnapshots(NewSnapshots(dir, SnapshotPolicy{Interval: time.Hour, MaxCount: 2}))
+
+	var rootID string
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		root := tasklist.AddTask("root", nil)
+		tasklist.AddTask("child", []*task.Task{root})
+		rootID = root.ID
+		return nil
+	})
+
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		tasklist.Delete(tasklist.Registry[rootID])
+		return nil
+	})
+
+	snapshots, err := store.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 2 {
+		t.Fatalf("Expected a snapshot on first change and before the delete, got %v", len(snapshots))
+	}
+
+	beforeDelete := snapshots[len(snapshots)-1]
+	if beforeDelete.TaskCount != 2 {
+		t.Fatalf("Snapshot before the delete should hold both tasks, holds %v", beforeDelete.TaskCount)
+	}
+
+	if err := store.RestoreSnapshot(Mutation{}, beforeDelete.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	store.View(func(tasklist *task.Tasklist) error {
+		root, ok := tasklist.Registry[rootID]
+		if !ok || len(root.Subtasks) != 1 || len(tasklist.RootTasks) != 1 {
+			t.Fatal("Deleted tasks should be back after restoring")
+		}
+		return nil
+	})
+
+	snapshots, _ = store.Snapshots()
+	if len(snapshots) != 2 {
+		t.Fatalf("Retention policy should keep only 2 snapshots, kept %v", len(snapshots))
+	}
+
+	if _, err := store.SnapshotAsOf(time.Unix(0, 0)); err != ErrSnapshotNotFound {
+		t.Fatalf("Expected no snapshot from before any were taken, got %v", err)
+	}
+}
+
+func TestAuditLogRecordsCascades(t *testing.T) {
+	dir, err := ioutil.TempDir("", "todo-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := Open(NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.KeepAuditLog(NewAuditLog(filepath.Join(dir, "audit.log")))
+
+	var root, child *task.Task
+	store.Update(Mutation{Actor: "tester"}, func(tasklist *task.Tasklist) error {
+		root = tasklist.AddTask("root", nil)
+		child = tasklist.AddTask("child", []*task.Task{root})
+		return nil
+	})
+
+	store.Update(Mutation{Actor: "tester", TaskID: child.ID}, func(tasklist *task.Tasklist) error {
+		child, _ := tasklist.Get(child.ID)
+		child.MarkAsComplete()
+		return nil
+	})
+
+	history, err := store.History(root.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history) != 2 || history[0].Action != AuditActionCreate {
+		t.Fatalf("Expected a create and an update event for the root, got %+v", history)
+	}
+
+	completion := history[1]
+	if !completion.Cascade || completion.CauseID != child.ID || completion.Actor != "tester" {
+		t.Fatalf("Root completion should be recorded as a cascade from the child, got %+v", completion)
+	}
+
+	if len(completion.Changes) != 1 || completion.Changes[0].Field != "complete" ||
+		completion.Changes[0].Before != false || completion.Changes[0].After != true {
+		t.Fatalf("Expected only the complete field to change, got %+v", completion.Changes)
+	}
+}
+
+func TestUndoRedoCascades(t *testing.T) {
+	store, err := Open(NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.KeepUndoHistory(10)
+
+	var root, child *task.Task
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		root = tasklist.AddTask("root", nil)
+		child = tasklist.AddTask("child", []*task.Task{root})
+		tasklist.AddTask("grandchild", []*task.Task{child})
+		return nil
+	})
+
+	// Undoing bumps revision numbers like any other change, everything
+	// else about the tasks should be put back exactly.
+	records := func() []Task {
+		var records []Task
+		store.View(func(tasklist *task.Tasklist) error {
+			records = tasklist.Records()
+			return nil
+		})
+		for i := range records {
+			records[i].Revision = 0
+		}
+		return records
+	}
+
+	beforeDelete := records()
+
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		tasklist.Delete(tasklist.Registry[child.ID])
+		return nil
+	})
+	afterDelete := records()
+
+	revision, err := store.Undo(Mutation{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revision.TaskIDs) != 3 {
+		t.Fatalf("Expected the delete to have touched 3 tasks, got %v", revision.TaskIDs)
+	}
+	if !reflect.DeepEqual(records(), beforeDelete) {
+		t.Fatalf("Undo should restore the deleted branch exactly, got %+v", records())
+	}
+
+	if _, err := store.Redo(Mutation{}); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(records(), afterDelete) {
+		t.Fatalf("Redo should delete the branch again, got %+v", records())
+	}
+
+	store.Undo(Mutation{})
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		root, _ := tasklist.Get(root.ID)
+		root.Name = "renamed"
+		return nil
+	})
+
+	if _, err := store.Redo(Mutation{}); err != ErrNothingToRedo {
+		t.Fatalf("A new change should clear the redo history, got %v", err)
+	}
+}
+
+func TestStoreBumpsRevisions(t *testing.T) {
+	store, err := Open(NewMemory())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.KeepUndoHistory(10)
+
+	var root, child *task.Task
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		root = tasklist.AddTask("root", nil)
+		child = tasklist.AddTask("child", []*task.Task{root})
+		return nil
+	})
+
+	version := store.Version()
+
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		child, _ := tasklist.Get(child.ID)
+		child.Name = "renamed"
+		return nil
+	})
+	store.Undo(Mutation{})
+
+	if store.Version() == version {
+		t.Fatal("Storing an update should change the store's version")
+	}
+
+	store.View(func(tasklist *task.Tasklist) error {
+		if revision := tasklist.Registry[root.ID].Revision; revision != 1 {
+			t.Errorf("Untouched task should still be at revision 1, got %v", revision)
+		}
+		if revision := tasklist.Registry[child.ID].Revision; revision != 3 {
+			t.Errorf("Renamed then undone task should be at revision 3, got %v", revision)
+		}
+		return nil
+	})
+}
+
+func TestStoreKeepsSearchIndexUpToDate(t *testing.T) {
+	backend := NewMemory()
+	backend.Save([]Task{{ID: "a", Name: "Deploy the website", Categories: []string{}}})
+
+	store, err := Open(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.KeepSearchIndex()
+	store.KeepUndoHistory(10)
+
+	search := func(query string) []string {
+		results, err := store.Search(query)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ids := []string{}
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		return ids
+	}
+
+	if ids := search("deploying"); len(ids) != 1 || ids[0] != "a" {
+		t.Fatalf("Expected the loaded task to be indexed, got %v", ids)
+	}
+
+	var added string
+	store.Update(Mutation{}, func(tasklist *task.Tasklist) error {
+		t, _ := tasklist.CreateTask("Write release notes", nil)
+		t.Notes = "Mention the website deploy"
+		added = t.ID
+
+		tasklist.Delete(tasklist.Registry["a"])
+		return nil
+	})
+
+	if ids := search("deploy"); len(ids) != 1 || ids[0] != added {
+		t.Fatalf("Expected only the new task to match, got %v", ids)
+	}
+
+	store.Undo(Mutation{})
+
+	if ids := search("web"); len(ids) != 1 || ids[0] != "a" {
+		t.Fatalf("Expected undo to put the index back, got %v", ids)
+	}
+}
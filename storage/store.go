@@ -0,0 +1,498 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jeffbmartinez/log"
+
+	"github.com/jeffbmartinez/todo-persistence/fulltext"
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
+/*
+Store keeps a tasklist in memory, loaded from a Backend once when the store
+is opened. Reads are served straight from memory, and every update is
+written through to the backend before it is made visible to readers.
+*/
+type Store struct {
+	lock sync.RWMutex
+
+	backend  Backend
+	tasklist task.Tasklist
+
+	/*
+		persisted holds the serialized form of every task as it was last
+		written to the backend. Comparing against it after an update tells
+		us which tasks need to be written.
+	*/
+	persisted map[string]Task
+
+	/*
+		version counts the updates stored since the store was opened. The
+		boot ID tells apart versions counted by different runs of the
+		server.
+	*/
+	bootID  string
+	version int64
+
+	snapshots *Snapshots
+	auditLog  *AuditLog
+	history   undoHistory
+	index     *fulltext.Index
+}
+
+/*
+Open loads the tasklist from the backend and returns a Store serving it.
+*/
+func Open(backend Backend) (*Store, error) {
+	serializableTasks, err := backend.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	tasklist := task.NewTasklistFromRecords(serializableTasks)
+
+	return &Store{
+		backend:   backend,
+		tasklist:  tasklist,
+		persisted: serializeRegistry(tasklist),
+		bootID:    strconv.FormatInt(time.Now().UnixNano(), 36),
+	}, nil
+}
+
+/*
+View hands the tasklist to the view function for reading. Any number of
+views can run at the same time, but never alongside an update. The
+tasklist, and every task in it, must not be modified by the view function
+or used after it returns.
+*/
+func (s *Store) View(view func(tasklist *task.Tasklist) error) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return view(&s.tasklist)
+}
+
+/*
+Update hands the tasklist to the update function for modification and then
+writes the tasks which were added, changed or removed to the backend. Every
+changed task has its Revision bumped and its ModifiedDate brought up to
+date. The changes are recorded in the audit log as part of the described
+mutation, and in the undo history as a single revision.
+
+Only the tasks the update function reaches through the tasklist (see
+Tasklist.Track), and the tasks above and below them, are checked for
+changes. A task found some other way has to be linked to one of those for
+its changes to be stored.
+
+If the update function returns an error having changed something, or the
+changes can't be written, the in-memory tasklist is rolled back to how it
+was before the update. Either way the error is returned as is.
+*/
+func (s *Store) Update(mutation Mutation, update func(tasklist *task.Tasklist) error) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tasklist.Track()
+	err := update(&s.tasklist)
+	touched := s.tasklist.Touched()
+
+	if err != nil {
+		if !s.diff(touched).IsEmpty() {
+			s.rollback()
+		}
+		return err
+	}
+
+	revision, err := s.commit(mutation, touched, false, true)
+	if err != nil {
+		s.rollback()
+		return err
+	}
+
+	s.remember(revision)
+
+	return nil
+}
+
+/*
+commit persists everything which changed in the in-memory tasklist since it
+was last persisted, looking around the touched tasks (see diff), and returns
+the changes as a revision. A snapshot of the tasklist as it was before the
+changes is taken first if forced to, if tasks are being deleted or if one is
+due.
+
+Changed tasks always have their Revision bumped, but only have their
+ModifiedDate brought up to date when told to touch them. Changes which put
+tasks back the way they were, as when undoing, leave it alone.
+*/
+func (s *Store) commit(mutation Mutation, touched map[string]bool, forceSnapshot bool, touch bool) (Revision, error) {
+	now := time.Now()
+
+	changes := s.diff(touched)
+	if changes.IsEmpty() {
+		return Revision{}, nil
+	}
+
+	for i, changed := range changes.Puts {
+		previous, existed := s.persisted[changed.ID]
+
+		// Revisions only ever go up, even when undoing puts back a task
+		// with an older revision number.
+		if previous.Revision > changed.Revision {
+			changed.Revision = previous.Revision
+		}
+		changed.Revision++
+
+		if touch && existed {
+			changed.ModifiedDate = now.Unix()
+		}
+
+		stored := s.tasklist.Registry[changed.ID]
+		stored.Revision = changed.Revision
+		stored.ModifiedDate = changed.ModifiedDate
+
+		changes.Puts[i] = changed
+	}
+
+	snapshotDue := forceSnapshot || len(changes.Deletes) > 0 || s.snapshots.isDue(now)
+	if s.snapshots != nil && snapshotDue {
+		if _, err := s.snapshots.Take(sortedTasks(s.persisted)); err != nil {
+			return Revision{}, err
+		}
+	}
+
+	if err := s.backend.Apply(changes); err != nil {
+		return Revision{}, err
+	}
+
+	if s.auditLog != nil {
+		events := auditEvents(mutation, s.persisted, changes, now.Unix())
+		if err := s.auditLog.Record(events); err != nil {
+			// The changes are already stored, so there's no going back.
+			log.Errorf("Couldn't record changes in audit log (%v)", err)
+		}
+	}
+
+	if s.index != nil {
+		updateIndex(s.index, changes)
+	}
+
+	revision := newRevision(mutation, s.persisted, changes, now.Unix())
+
+	for _, changed := range changes.Puts {
+		s.persisted[changed.ID] = changed
+	}
+	for _, taskID := range changes.Deletes {
+		delete(s.persisted, taskID)
+	}
+	s.version++
+
+	return revision, nil
+}
+
+/*
+diff compares the in-memory tasklist with the persisted tasks and returns
+the changes between them. A change only ever spreads from the tasks it
+touched to the tasks above and below them, so only those are compared,
+both as they are now and as they were persisted. With touched nil, as when
+the whole tasklist has been replaced, every task is compared.
+*/
+func (s *Store) diff(touched map[string]bool) Changeset {
+	if touched == nil {
+		return diffTasks(s.persisted, serializeRegistry(s.tasklist))
+	}
+
+	before := make(map[string]Task)
+	after := make(map[string]Task)
+	for id := range s.related(touched) {
+		if persisted, ok := s.persisted[id]; ok {
+			before[id] = persisted
+		}
+		if t, ok := s.tasklist.Registry[id]; ok {
+			after[id] = task.NewRecord(t)
+		}
+	}
+
+	return diffTasks(before, after)
+}
+
+/*
+related returns the IDs of the touched tasks along with every task above or
+below them, as they are now or as they were persisted.
+*/
+func (s *Store) related(touched map[string]bool) map[string]bool {
+	related := make(map[string]bool)
+
+	for _, up := range []bool{true, false} {
+		visited := make(map[string]bool, len(touched))
+		queue := make([]string, 0, len(touched))
+		for id := range touched {
+			visited[id] = true
+			queue = append(queue, id)
+		}
+
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			related[id] = true
+
+			for _, linkedID := range s.linked(id, up) {
+				if !visited[linkedID] {
+					visited[linkedID] = true
+					queue = append(queue, linkedID)
+				}
+			}
+		}
+	}
+
+	return related
+}
+
+/*
+linked returns the IDs of the task's parents, or its subtasks, as they are
+now and as they were persisted.
+*/
+func (s *Store) linked(taskID string, up bool) []string {
+	var ids []string
+
+	if persisted, ok := s.persisted[taskID]; ok {
+		if up {
+			ids = append(ids, persisted.ParentIDs...)
+		} else {
+			ids = append(ids, persisted.SubtaskIDs...)
+		}
+	}
+
+	if t, ok := s.tasklist.Registry[taskID]; ok {
+		linked := t.Subtasks
+		if up {
+			linked = t.Parents
+		}
+		for _, l := range linked {
+			ids = append(ids, l.ID)
+		}
+	}
+
+	return ids
+}
+
+/*
+remember adds a revision which actually changed something to the undo
+history.
+*/
+func (s *Store) remember(revision Revision) {
+	if len(revision.TaskIDs) > 0 {
+		s.history.push(revision)
+	}
+}
+
+/*
+Version identifies the current state of the whole tasklist. It changes
+every time an update is stored, and never repeats, even across restarts.
+*/
+func (s *Store) Version() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return fmt.Sprintf("%v-%v", s.bootID, s.version)
+}
+
+/*
+KeepSnapshots has the store take snapshots of its tasklist as it changes.
+It should be called before the store is used.
+*/
+func (s *Store) KeepSnapshots(snapshots *Snapshots) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.snapshots = snapshots
+}
+
+/*
+Snapshots describes every snapshot kept of the tasklist, oldest first.
+*/
+func (s *Store) Snapshots() ([]SnapshotInfo, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.snapshots == nil {
+		return nil, ErrSnapshotsDisabled
+	}
+
+	return s.snapshots.List()
+}
+
+/*
+TakeSnapshot takes a snapshot of the tasklist right away.
+*/
+func (s *Store) TakeSnapshot() (SnapshotInfo, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.snapshots == nil {
+		return SnapshotInfo{}, ErrSnapshotsDisabled
+	}
+
+	return s.snapshots.Take(sortedTasks(s.persisted))
+}
+
+/*
+SnapshotAsOf returns the ID of the snapshot holding the tasklist as it was
+at the given time, which is the newest snapshot taken at or before then.
+*/
+func (s *Store) SnapshotAsOf(when time.Time) (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.snapshots == nil {
+		return "", ErrSnapshotsDisabled
+	}
+
+	return s.snapshots.AsOf(when)
+}
+
+/*
+RestoreSnapshot replaces the whole tasklist with the one in a snapshot, as
+part of the described mutation. A snapshot of the tasklist as it was before
+the restore is taken first, so a restore can itself be undone.
+*/
+func (s *Store) RestoreSnapshot(mutation Mutation, id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.snapshots == nil {
+		return ErrSnapshotsDisabled
+	}
+
+	tasks, err := s.snapshots.Load(id)
+	if err != nil {
+		return err
+	}
+
+	s.tasklist = task.NewTasklistFromRecords(tasks)
+
+	revision, err := s.commit(mutation, nil, true, true)
+	if err != nil {
+		s.rollback()
+		return err
+	}
+
+	s.remember(revision)
+
+	return nil
+}
+
+/*
+KeepAuditLog has the store record every change made to its tasklist in the
+audit log. It should be called before the store is used.
+*/
+func (s *Store) KeepAuditLog(auditLog *AuditLog) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.auditLog = auditLog
+}
+
+/*
+History returns every change recorded in the audit log for a task, oldest
+first.
+*/
+func (s *Store) History(taskID string) ([]AuditEvent, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.auditLog == nil {
+		return nil, ErrAuditLogDisabled
+	}
+
+	return s.auditLog.History(taskID)
+}
+
+/*
+KeepUndoHistory has the store remember the last limit changes made to its
+tasklist, so they can be undone. The history is kept in memory only, and
+starts out empty each time the store is opened. It should be called before
+the store is used.
+*/
+func (s *Store) KeepUndoHistory(limit int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.history = undoHistory{limit: limit}
+}
+
+/*
+Undo reverts the most recent change made to the tasklist which hasn't been
+undone yet, as part of the described mutation, and returns the revision
+which was undone. Every task the change touched is put back exactly as it
+was, or removed again if the change created it.
+*/
+func (s *Store) Undo(mutation Mutation) (Revision, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	revision, ok := s.history.lastDone()
+	if !ok {
+		return Revision{}, ErrNothingToUndo
+	}
+
+	if err := s.revert(mutation, revision.undo); err != nil {
+		return Revision{}, err
+	}
+
+	s.history.undoLast()
+
+	return revision, nil
+}
+
+/*
+Redo makes the most recently undone change again, as part of the described
+mutation, and returns the revision which was redone. Making any other change
+in the meantime means there's nothing left to redo.
+*/
+func (s *Store) Redo(mutation Mutation) (Revision, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	revision, ok := s.history.lastUndone()
+	if !ok {
+		return Revision{}, ErrNothingToRedo
+	}
+
+	if err := s.revert(mutation, revision.redo); err != nil {
+		return Revision{}, err
+	}
+
+	s.history.redoLast()
+
+	return revision, nil
+}
+
+/*
+revert applies the changes to the persisted tasks, as they are, and commits
+the result.
+*/
+func (s *Store) revert(mutation Mutation, changes Changeset) error {
+	tasks := applyChangeset(sortedTasks(s.persisted), changes)
+	task.SortRecords(tasks)
+
+	s.tasklist = task.NewTasklistFromRecords(tasks)
+
+	if _, err := s.commit(mutation, nil, false, false); err != nil {
+		s.rollback()
+		return err
+	}
+
+	return nil
+}
+
+/*
+rollback rebuilds the in-memory tasklist from the last persisted state.
+*/
+func (s *Store) rollback() {
+	s.tasklist = task.NewTasklistFromRecords(sortedTasks(s.persisted))
+}
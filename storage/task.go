@@ -1,19 +1,12 @@
 package storage
 
+import (
+	"github.com/jeffbmartinez/todo-persistence/task"
+)
+
 /*
-Task is an easier to serialize version of task.Task.
+Task is the form tasks are stored in by backends. It is the same Record
+used to serialize a task.Tasklist, so the storage package and
+Tasklist.Store/Restore always agree on what a stored task looks like.
 */
-type Task struct {
-	ID       string
-	Name     string
-	Complete bool
-
-	CreatedDate  int64
-	ModifiedDate int64
-	DueDate      int64
-
-	Categories []string
-
-	ParentIDs  []string
-	SubtaskIDs []string
-}
+type Task = task.Record
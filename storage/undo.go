@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+)
+
+/*
+ErrNothingToUndo is returned when asked to undo with no changes left in the
+undo history.
+*/
+var ErrNothingToUndo = errors.New("Nothing to undo")
+
+/*
+ErrNothingToRedo is returned when asked to redo without having undone
+anything since the last change.
+*/
+var ErrNothingToRedo = errors.New("Nothing to redo")
+
+/*
+Revision describes a single change made to a tasklist, along with
+everything needed to undo it. A change which cascaded through many tasks is
+still a single revision, and undoing it puts back every task it touched.
+*/
+type Revision struct {
+	Time      int64  `json:"time"`
+	Actor     string `json:"actor"`
+	Operation string `json:"operation"`
+
+	/*
+		TaskIDs lists every task the change created, changed or deleted.
+	*/
+	TaskIDs []string `json:"taskIDs"`
+
+	undo Changeset
+	redo Changeset
+}
+
+/*
+newRevision describes the changes made to the tasks in before as an
+invertible revision.
+*/
+func newRevision(mutation Mutation, before map[string]Task, changes Changeset, now int64) Revision {
+	revision := Revision{
+		Time:      now,
+		Actor:     mutation.Actor,
+		Operation: mutation.Operation,
+		TaskIDs:   make([]string, 0, len(changes.Puts)+len(changes.Deletes)),
+		redo:      changes,
+	}
+
+	for _, put := range changes.Puts {
+		revision.TaskIDs = append(revision.TaskIDs, put.ID)
+
+		if previous, existed := before[put.ID]; existed {
+			revision.undo.Puts = append(revision.undo.Puts, previous)
+		} else {
+			revision.undo.Deletes = append(revision.undo.Deletes, put.ID)
+		}
+	}
+
+	for _, taskID := range changes.Deletes {
+		revision.TaskIDs = append(revision.TaskIDs, taskID)
+		revision.undo.Puts = append(revision.undo.Puts, before[taskID])
+	}
+
+	sort.Strings(revision.TaskIDs)
+
+	return revision
+}
+
+/*
+undoHistory keeps the most recent revisions made to a tasklist, so they can
+be undone, along with the ones undone since, so they can be redone.
+*/
+type undoHistory struct {
+	limit int
+
+	undone []Revision
+	done   []Revision
+}
+
+/*
+push records a newly made revision. Anything undone before it can no
+longer be redone.
+*/
+func (h *undoHistory) push(revision Revision) {
+	h.pushDone(revision)
+	h.undone = nil
+}
+
+func (h *undoHistory) pushDone(revision Revision) {
+	if h.limit <= 0 {
+		return
+	}
+
+	h.done = append(h.done, revision)
+	if len(h.done) > h.limit {
+		h.done = append([]Revision(nil), h.done[len(h.done)-h.limit:]...)
+	}
+}
+
+/*
+lastDone returns the most recent revision which can be undone.
+*/
+func (h *undoHistory) lastDone() (Revision, bool) {
+	if len(h.done) == 0 {
+		return Revision{}, false
+	}
+
+	return h.done[len(h.done)-1], true
+}
+
+/*
+lastUndone returns the most recently undone revision, which can be redone.
+*/
+func (h *undoHistory) lastUndone() (Revision, bool) {
+	if len(h.undone) == 0 {
+		return Revision{}, false
+	}
+
+	return h.undone[len(h.undone)-1], true
+}
+
+/*
+undoLast records that the last revision done has been undone.
+*/
+func (h *undoHistory) undoLast() {
+	last := len(h.done) - 1
+	h.undone = append(h.undone, h.done[last])
+	h.done = h.done[:last]
+}
+
+/*
+redoLast records that the last revision undone has been redone.
+*/
+func (h *undoHistory) redoLast() {
+	last := len(h.undone) - 1
+	h.pushDone(h.undone[last])
+	h.undone = h.undone[:last]
+}
@@ -0,0 +1,185 @@
+package task
+
+/*
+AddBlocker records that a task can't be done until blocker is. Blockers are
+separate from subtasks, and can be anywhere in the tasklist. If blocker
+already blocks the task, nothing happens.
+
+A task can't end up waiting on itself. If the blocker is the task itself,
+or is already waiting on the task (see WaitingOn), a DependencyCycleError
+is returned and nothing is changed.
+*/
+func (t *Task) AddBlocker(blocker *Task) error {
+	if findTaskInSlice(t.BlockedBy, blocker.ID) != -1 {
+		return nil
+	}
+
+	if blocker.ID == t.ID || isWaitingOn(blocker, t) {
+		return NewDependencyCycleError(t.ID, blocker.ID)
+	}
+
+	t.BlockedBy = append(t.BlockedBy, blocker)
+	blocker.Blocks = append(blocker.Blocks, t)
+
+	return nil
+}
+
+/*
+RemoveBlocker takes blocker out of the tasks blocking the task. If it isn't
+one of them, nothing happens.
+*/
+func (t *Task) RemoveBlocker(blocker *Task) {
+	if findTaskInSlice(t.BlockedBy, blocker.ID) == -1 {
+		return
+	}
+
+	t.BlockedBy = deleteFromSliceByID(t.BlockedBy, blocker.ID)
+	blocker.Blocks = deleteFromSliceByID(blocker.Blocks, t.ID)
+}
+
+/*
+IsBlockedBy returns true if the task with the supplied ID is one of the
+tasks blocking the task, whether or not it's complete.
+*/
+func (t Task) IsBlockedBy(blockerID string) bool {
+	return findTaskInSlice(t.BlockedBy, blockerID) != -1
+}
+
+/*
+IsBlocked returns true if any of the tasks blocking the task are still
+incomplete.
+*/
+func (t Task) IsBlocked() bool {
+	for _, blocker := range t.BlockedBy {
+		if !blocker.Complete {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+OutstandingBlockers returns the incomplete tasks standing in the way of
+completing the task. Completing a task completes everything below it too,
+so that's anything blocking the task or one of its incomplete descendants,
+other than the tasks which would be completed along with it.
+*/
+func (t *Task) OutstandingBlockers() []*Task {
+	completing := map[string]bool{t.ID: true}
+	tasks := []*Task{t}
+	for _, descendant := range walk(t, func(t *Task) []*Task { return t.Subtasks }) {
+		if !descendant.Complete {
+			completing[descendant.ID] = true
+			tasks = append(tasks, descendant)
+		}
+	}
+
+	blockers := []*Task{}
+	for _, task := range tasks {
+		for _, blocker := range task.BlockedBy {
+			if !blocker.Complete && !completing[blocker.ID] && findTaskInSlice(blockers, blocker.ID) == -1 {
+				blockers = append(blockers, blocker)
+			}
+		}
+	}
+
+	return blockers
+}
+
+/*
+GuardBlocked runs change, which may complete tasks, and fails with a
+BlockedError if it completed a task still waiting on incomplete tasks.
+That includes tasks completed along the way, subtasks completed along with
+their parent and parents completed once their last subtask is, not only
+the ones change set out to complete. Tasks which were already complete
+aren't checked again.
+
+Unless force is true, the error is returned for the first such task (by
+creation date) and the change should be abandoned. With force, blocked
+tasks are completed anyway.
+*/
+func (ts *Tasklist) GuardBlocked(force bool, change func() error) error {
+	wasIncomplete := make(map[string]bool)
+	for id, t := range ts.Registry {
+		if !t.Complete {
+			wasIncomplete[id] = true
+		}
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	if force {
+		return nil
+	}
+
+	blocked := []*Task{}
+	for id := range wasIncomplete {
+		if t, ok := ts.Registry[id]; ok && t.Complete && t.IsBlocked() {
+			blocked = append(blocked, t)
+		}
+	}
+
+	if len(blocked) == 0 {
+		return nil
+	}
+
+	Ordering{Field: SortByCreatedDate}.Sort(blocked)
+
+	blockers := []*Task{}
+	for _, blocker := range blocked[0].BlockedBy {
+		if !blocker.Complete {
+			blockers = append(blockers, blocker)
+		}
+	}
+
+	return NewBlockedError(blocked[0].ID, blockers)
+}
+
+/*
+HasBlockedAncestor returns true if any task above the task is blocked.
+*/
+func (ts Tasklist) HasBlockedAncestor(task *Task) bool {
+	for _, ancestor := range ts.Ancestors(task) {
+		if ancestor.IsBlocked() {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+WaitingOn returns the tasks which have to be done before the task can be,
+its subtasks and the tasks blocking it. Following it must never lead back
+to the task, AddBlocker and AddSubtask refuse any edge which would.
+*/
+func (t *Task) WaitingOn() []*Task {
+	waitingOn := make([]*Task, 0, len(t.Subtasks)+len(t.BlockedBy))
+	waitingOn = append(waitingOn, t.Subtasks...)
+
+	for _, blocker := range t.BlockedBy {
+		if findTaskInSlice(waitingOn, blocker.ID) == -1 {
+			waitingOn = append(waitingOn, blocker)
+		}
+	}
+
+	return waitingOn
+}
+
+/*
+isWaitingOn returns true if task can be reached from waiting by following
+WaitingOn, through subtasks and blockers alike, meaning waiting can't be
+done until task is.
+*/
+func isWaitingOn(waiting *Task, task *Task) bool {
+	for _, waitedOn := range walk(waiting, (*Task).WaitingOn) {
+		if waitedOn.ID == task.ID {
+			return true
+		}
+	}
+
+	return false
+}
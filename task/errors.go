@@ -2,6 +2,7 @@ package task
 
 import (
 	"fmt"
+	"strings"
 )
 
 /*
@@ -10,6 +11,7 @@ that there was a problem creating a new task.
 */
 type UnableToCreateTaskError struct {
 	reason string
+	field  string
 }
 
 /*
@@ -26,6 +28,14 @@ func (t UnableToCreateTaskError) Error() string {
 	return fmt.Sprintf("Unable to create new task (%v)", t.reason)
 }
 
+/*
+Field returns the name of the field which kept the task from being
+created, if the problem was down to a single field.
+*/
+func (t UnableToCreateTaskError) Field() string {
+	return t.field
+}
+
 ////////////////////////////////
 
 /*
@@ -33,6 +43,7 @@ NotFoundError is used to signify that a task which was
 expected to exist could not be found or retrieved.
 */
 type NotFoundError struct {
+	taskID       string
 	errorMessage string
 }
 
@@ -42,6 +53,7 @@ an error message.
 */
 func NewNotFoundError(taskID string) NotFoundError {
 	return NotFoundError{
+		taskID:       taskID,
 		errorMessage: fmt.Sprintf("Could not find task with id '%v'", taskID),
 	}
 }
@@ -49,3 +61,133 @@ func NewNotFoundError(taskID string) NotFoundError {
 func (t NotFoundError) Error() string {
 	return t.errorMessage
 }
+
+/*
+TaskID returns the ID of the task which couldn't be found.
+*/
+func (t NotFoundError) TaskID() string {
+	return t.taskID
+}
+
+////////////////////////////////
+
+/*
+CycleError is used to signify that two tasks couldn't be linked because
+the subtask is already the parent task, or one of its ancestors. Linking
+them would make a task its own ancestor.
+*/
+type CycleError struct {
+	ParentID  string
+	SubtaskID string
+}
+
+/*
+NewCycleError creates an error for the refused link between the parent and
+subtask with the supplied IDs.
+*/
+func NewCycleError(parentID string, subtaskID string) CycleError {
+	return CycleError{
+		ParentID:  parentID,
+		SubtaskID: subtaskID,
+	}
+}
+
+func (t CycleError) Error() string {
+	return fmt.Sprintf("Making task '%v' a subtask of task '%v' would make it its own ancestor", t.SubtaskID, t.ParentID)
+}
+
+/*
+DependencyCycleError is used to signify that a task couldn't be blocked by
+another because the blocker is the task itself, or is already waiting on
+the task. Adding the dependency would leave both waiting forever.
+*/
+type DependencyCycleError struct {
+	TaskID    string
+	BlockerID string
+}
+
+/*
+NewDependencyCycleError creates an error for the refused dependency of the
+task on the blocker with the supplied IDs.
+*/
+func NewDependencyCycleError(taskID string, blockerID string) DependencyCycleError {
+	return DependencyCycleError{
+		TaskID:    taskID,
+		BlockerID: blockerID,
+	}
+}
+
+func (t DependencyCycleError) Error() string {
+	return fmt.Sprintf("Making task '%v' wait on task '%v' would make it wait on itself", t.TaskID, t.BlockerID)
+}
+
+/*
+BlockedError is used to signify that a task can't be completed because
+other tasks it (or something below it) is waiting on are still incomplete.
+*/
+type BlockedError struct {
+	TaskID     string
+	BlockerIDs []string
+}
+
+/*
+NewBlockedError creates an error for the task with the supplied ID, held up
+by the supplied blockers.
+*/
+func NewBlockedError(taskID string, blockers []*Task) BlockedError {
+	blockerIDs := make([]string, 0, len(blockers))
+	for _, blocker := range blockers {
+		blockerIDs = append(blockerIDs, blocker.ID)
+	}
+
+	return BlockedError{
+		TaskID:     taskID,
+		BlockerIDs: blockerIDs,
+	}
+}
+
+func (t BlockedError) Error() string {
+	return fmt.Sprintf("Task '%v' is waiting on incomplete tasks %v", t.TaskID, strings.Join(t.BlockerIDs, ", "))
+}
+
+/*
+TimerRunningError is used to signify that a task's timer couldn't be
+started because it's already running.
+*/
+type TimerRunningError struct {
+	TaskID string
+}
+
+/*
+NewTimerRunningError creates an error for the task with the supplied ID.
+*/
+func NewTimerRunningError(taskID string) TimerRunningError {
+	return TimerRunningError{
+		TaskID: taskID,
+	}
+}
+
+func (t TimerRunningError) Error() string {
+	return fmt.Sprintf("The timer of task '%v' is already running", t.TaskID)
+}
+
+/*
+TimerNotRunningError is used to signify that a task's timer couldn't be
+stopped because it isn't running.
+*/
+type TimerNotRunningError struct {
+	TaskID string
+}
+
+/*
+NewTimerNotRunningError creates an error for the task with the supplied ID.
+*/
+func NewTimerNotRunningError(taskID string) TimerNotRunningError {
+	return TimerNotRunningError{
+		TaskID: taskID,
+	}
+}
+
+func (t TimerNotRunningError) Error() string {
+	return fmt.Sprintf("The timer of task '%v' isn't running", t.TaskID)
+}
@@ -0,0 +1,183 @@
+package task
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+Filter picks out tasks by their fields. The zero value of each field of the
+filter matches every task, so only the fields which are set narrow things
+down. Ranges include their After bound and exclude their Before bound, and
+tasks without a due date never match a due date range.
+*/
+type Filter struct {
+	Complete *bool
+
+	/*
+		Categories matches tasks in any of the categories listed.
+	*/
+	Categories []string
+
+	/*
+		NameContains matches tasks whose name contains it, ignoring case.
+	*/
+	NameContains string
+
+	DueAfter       int64
+	DueBefore      int64
+	CreatedAfter   int64
+	CreatedBefore  int64
+	ModifiedAfter  int64
+	ModifiedBefore int64
+}
+
+/*
+Matches returns true if the task passes every part of the filter.
+*/
+func (f Filter) Matches(t *Task) bool {
+	if f.Complete != nil && t.Complete != *f.Complete {
+		return false
+	}
+
+	if len(f.Categories) > 0 && !hasAnyCategory(t, f.Categories) {
+		return false
+	}
+
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(t.Name), strings.ToLower(f.NameContains)) {
+		return false
+	}
+
+	if (f.DueAfter != 0 || f.DueBefore != 0) && t.DueDate == 0 {
+		return false
+	}
+
+	return inRange(t.DueDate, f.DueAfter, f.DueBefore) &&
+		inRange(t.CreatedDate, f.CreatedAfter, f.CreatedBefore) &&
+		inRange(t.ModifiedDate, f.ModifiedAfter, f.ModifiedBefore)
+}
+
+func hasAnyCategory(t *Task, categories []string) bool {
+	for _, category := range categories {
+		for _, taskCategory := range t.Categories {
+			if strings.EqualFold(category, taskCategory) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func inRange(value int64, after int64, before int64) bool {
+	return (after == 0 || value >= after) && (before == 0 || value < before)
+}
+
+/*
+Fields tasks can be sorted by.
+*/
+const (
+	SortByName         = "name"
+	SortByCreatedDate  = "createdDate"
+	SortByModifiedDate = "modifiedDate"
+	SortByDueDate      = "dueDate"
+	SortByPriority     = "priority"
+)
+
+/*
+Ordering sorts tasks by one of their fields. Tasks which tie on the field
+are ordered by ID, so an ordering never depends on the order tasks started
+out in. Tasks without a due date sort after every task with one.
+*/
+type Ordering struct {
+	Field      string
+	Descending bool
+}
+
+/*
+ParseOrdering reads an ordering written as a field name, optionally
+prefixed with "-" for descending order ("-dueDate"). The empty string is
+ascending creation date, the order tasks are normally listed in.
+*/
+func ParseOrdering(s string) (Ordering, error) {
+	ordering := Ordering{
+		Field:      strings.TrimPrefix(s, "-"),
+		Descending: strings.HasPrefix(s, "-"),
+	}
+
+	switch ordering.Field {
+	case "":
+		ordering.Field = SortByCreatedDate
+	case SortByName, SortByCreatedDate, SortByModifiedDate, SortByDueDate, SortByPriority:
+	default:
+		return Ordering{}, fmt.Errorf("can't sort by '%v'", ordering.Field)
+	}
+
+	return ordering, nil
+}
+
+/*
+String returns the ordering as ParseOrdering reads it.
+*/
+func (o Ordering) String() string {
+	if o.Descending {
+		return "-" + o.Field
+	}
+
+	return o.Field
+}
+
+/*
+Less returns true if a comes before b.
+*/
+func (o Ordering) Less(a *Task, b *Task) bool {
+	if compared := o.compare(a, b); compared != 0 {
+		return (compared < 0) != o.Descending
+	}
+
+	return (a.ID < b.ID) != o.Descending
+}
+
+/*
+Sort sorts the tasks in place.
+*/
+func (o Ordering) Sort(tasks []*Task) {
+	sort.Slice(tasks, func(i, j int) bool {
+		return o.Less(tasks[i], tasks[j])
+	})
+}
+
+func (o Ordering) compare(a *Task, b *Task) int {
+	switch o.Field {
+	case SortByName:
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	case SortByModifiedDate:
+		return compareInts(a.ModifiedDate, b.ModifiedDate)
+	case SortByDueDate:
+		return compareInts(dueDateSortKey(a), dueDateSortKey(b))
+	case SortByPriority:
+		return compareInts(int64(a.Priority), int64(b.Priority))
+	}
+
+	return compareInts(a.CreatedDate, b.CreatedDate)
+}
+
+func dueDateSortKey(t *Task) int64 {
+	if t.DueDate == 0 {
+		return MaxDueDate + 1
+	}
+
+	return t.DueDate
+}
+
+func compareInts(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+
+	return 0
+}
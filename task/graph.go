@@ -0,0 +1,117 @@
+package task
+
+/*
+Ancestors returns every task above the task, following parents all the way
+up to the root tasks. Each ancestor is listed once, nearest first.
+*/
+func (ts Tasklist) Ancestors(task *Task) []*Task {
+	return walk(task, func(t *Task) []*Task { return t.Parents })
+}
+
+/*
+Descendants returns every task below the task, following subtasks all the
+way down. Each descendant is listed once, nearest first.
+*/
+func (ts Tasklist) Descendants(task *Task) []*Task {
+	return walk(task, func(t *Task) []*Task { return t.Subtasks })
+}
+
+/*
+IsAncestor returns true if ancestor can be reached from task by following
+parents, which is the same as task being reachable from ancestor by
+following subtasks. A task isn't its own ancestor.
+*/
+func (ts Tasklist) IsAncestor(ancestor *Task, task *Task) bool {
+	return isReachable(ancestor, task)
+}
+
+/*
+isReachable returns true if to can be reached from from by following
+subtasks.
+*/
+func isReachable(from *Task, to *Task) bool {
+	for _, descendant := range walk(from, func(t *Task) []*Task { return t.Subtasks }) {
+		if descendant.ID == to.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+walk visits every task reachable from the task (but not the task itself) by
+repeatedly following next, breadth first. Tasks reachable through more than
+one path are only visited once.
+*/
+func walk(task *Task, next func(t *Task) []*Task) []*Task {
+	visited := map[string]bool{task.ID: true}
+	found := []*Task{}
+
+	queue := []*Task{task}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, t := range next(current) {
+			if visited[t.ID] {
+				continue
+			}
+
+			visited[t.ID] = true
+			found = append(found, t)
+			queue = append(queue, t)
+		}
+	}
+
+	return found
+}
+
+/*
+removeCycles drops every edge which closes a cycle, visiting tasks in the
+order supplied and following edges with next. Tasks can't be linked into a
+cycle, but tasklists stored before that was enforced might contain one.
+*/
+func removeCycles(tasks []*Task, next func(t *Task) []*Task, unlink func(from *Task, to *Task)) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	state := make(map[string]int)
+
+	var visit func(t *Task)
+	visit = func(t *Task) {
+		state[t.ID] = visiting
+
+		// Dropping an edge changes the slice of edges, so work from a copy.
+		for _, to := range append([]*Task(nil), next(t)...) {
+			switch state[to.ID] {
+			case visiting:
+				unlink(t, to)
+			case unvisited:
+				visit(to)
+			}
+		}
+
+		state[t.ID] = visited
+	}
+
+	for _, t := range tasks {
+		if state[t.ID] == unvisited {
+			visit(t)
+		}
+	}
+}
+
+/*
+unlinkSubtask drops the edge between a parent and subtask, without any of
+the completion changes RemoveSubtask makes.
+*/
+func unlinkSubtask(parent *Task, subtask *Task) {
+	parent.Subtasks = deleteFromSliceByID(parent.Subtasks, subtask.ID)
+	if findTaskInSlice(subtask.Parents, parent.ID) != -1 {
+		subtask.Parents = deleteFromSliceByID(subtask.Parents, parent.ID)
+	}
+}
@@ -0,0 +1,55 @@
+package task
+
+import (
+	"sort"
+)
+
+/*
+NextActions returns the tasks which can be worked on right now, most
+pressing first. Those are the incomplete tasks with no incomplete subtasks
+left, as anything with incomplete subtasks is waiting on them. Blocked
+tasks, and tasks below a blocked task, are waiting on something else and
+are left out too.
+
+Tasks are ranked by priority (highest first), then by due date (soonest
+first, tasks without one last), then by age (oldest first).
+*/
+func (ts Tasklist) NextActions() []*Task {
+	actions := []*Task{}
+	for _, t := range ts.Registry {
+		if !t.Complete && !hasIncompleteSubtasks(t) && !t.IsBlocked() && !ts.HasBlockedAncestor(t) {
+			actions = append(actions, t)
+		}
+	}
+
+	sort.Slice(actions, func(i, j int) bool {
+		return ranksBefore(actions[i], actions[j])
+	})
+
+	return actions
+}
+
+func hasIncompleteSubtasks(t *Task) bool {
+	for _, subtask := range t.Subtasks {
+		if !subtask.Complete {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+ranksBefore returns true if a is a more pressing next action than b.
+*/
+func ranksBefore(a *Task, b *Task) bool {
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+
+	if dueA, dueB := dueDateSortKey(a), dueDateSortKey(b); dueA != dueB {
+		return dueA < dueB
+	}
+
+	return Ordering{Field: SortByCreatedDate}.Less(a, b)
+}
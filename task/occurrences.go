@@ -0,0 +1,149 @@
+package task
+
+import (
+	"time"
+)
+
+/*
+Recur runs change, which may complete tasks, and then creates the next
+occurrence of every recurring task it completed (see NextOccurrence).
+Tasks which were already complete before the change don't recur again.
+
+Completing a recurring subtask can complete its parents along with it, and
+they stay complete: the subtask's next occurrence only goes under the
+parents still incomplete afterwards, and isn't created at all if there are
+none. A parent which recurs carries its recurring subtasks on in its own
+next occurrence, where they're cloned along with the rest of its subtasks.
+*/
+func (ts *Tasklist) Recur(change func() error) error {
+	wasIncomplete := make(map[string]bool)
+	for id, t := range ts.Registry {
+		if !t.Complete && t.Recurrence != "" {
+			wasIncomplete[id] = true
+		}
+	}
+
+	if err := change(); err != nil {
+		return err
+	}
+
+	// Go through the completed tasks in a fixed order, so the occurrences
+	// created don't depend on the order of the registry.
+	completed := []*Task{}
+	for id := range wasIncomplete {
+		if t, ok := ts.Registry[id]; ok && t.Complete {
+			completed = append(completed, t)
+		}
+	}
+	Ordering{Field: SortByCreatedDate}.Sort(completed)
+
+	now := time.Now()
+	for _, t := range completed {
+		if _, err := ts.NextOccurrence(t, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+NextOccurrence creates the occurrence of a recurring task following it,
+under the same parents, and returns it. The new occurrence is due when the
+task's recurrence rule says, counting on from the task's due date, or from
+now if it had none. Its subtasks are cloned from the task's, incomplete,
+with any due dates they had shifted along with it. A monthly series is
+anchored to the day of the month it started on (see Recurrence.Anchor),
+which is written into the rule of the task and its occurrences.
+
+A complete parent is done with, and adding an incomplete task under it
+would reopen it, so the occurrence is only added under parents which are
+still incomplete. Nothing is created, and nil is returned, if the task
+doesn't recur, its series has ended, or it had parents and every one of
+them is complete.
+*/
+func (ts *Tasklist) NextOccurrence(t *Task, now time.Time) (*Task, error) {
+	if t.Recurrence == "" {
+		return nil, nil
+	}
+
+	parents := make([]*Task, 0, len(t.Parents))
+	for _, parent := range t.Parents {
+		if !parent.Complete {
+			parents = append(parents, parent)
+		}
+	}
+	if len(t.Parents) > 0 && len(parents) == 0 {
+		return nil, nil
+	}
+
+	recurrence, err := ParseRecurrence(t.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.SeriesID == "" {
+		t.SeriesID = t.ID
+		t.Occurrence = 1
+	}
+
+	from := now
+	if t.DueDate != 0 {
+		from = time.Unix(t.DueDate, 0)
+	}
+
+	// Pin monthly series to the day they started on, so they don't drift
+	// to the end of the shortest month they pass through.
+	recurrence = recurrence.Anchor(from)
+	t.Recurrence = recurrence.String()
+
+	next := recurrence.Next(from)
+	if recurrence.Ends(t.Occurrence, next) {
+		return nil, nil
+	}
+
+	shift := next.Unix() - from.Unix()
+
+	occurrence := ts.cloneTree(t, parents, shift, make(map[string]*Task))
+	occurrence.Recurrence = t.Recurrence
+	occurrence.SeriesID = t.SeriesID
+	occurrence.Occurrence = t.Occurrence + 1
+	occurrence.DueDate = next.Unix()
+
+	return occurrence, nil
+}
+
+/*
+cloneTree adds an incomplete copy of a task, and of every task below it,
+to the tasklist under the given parents. A task reached through several
+paths is only copied once, keeping the shape of the tree. Due dates of the
+copies are moved by shift seconds. Recurring tasks below the task keep
+their recurrence rule, each copy starting a series of its own.
+*/
+func (ts *Tasklist) cloneTree(t *Task, parents []*Task, shift int64, clones map[string]*Task) *Task {
+	clone := ts.AddTask(t.Name, parents)
+	clone.Notes = t.Notes
+	clone.Priority = t.Priority
+	clone.Estimate = t.Estimate
+	clone.Recurrence = t.Recurrence
+	clone.Categories = copyStrings(t.Categories)
+	if clone.Categories == nil {
+		clone.Categories = []string{}
+	}
+	if t.DueDate != 0 {
+		clone.DueDate = t.DueDate + shift
+	}
+
+	clones[t.ID] = clone
+
+	for _, subtask := range t.Subtasks {
+		if existing, ok := clones[subtask.ID]; ok {
+			clone.AddSubtask(existing)
+			continue
+		}
+
+		ts.cloneTree(subtask, []*Task{clone}, shift, clones)
+	}
+
+	return clone
+}
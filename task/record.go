@@ -0,0 +1,256 @@
+package task
+
+import (
+	"sort"
+)
+
+/*
+Record is the serializable form of a Task. Rather than pointers to other
+tasks, a record holds the IDs of its parents and subtasks, which lets the
+whole task graph (tasks with multiple parents included) be written out
+and read back in without losing or duplicating anything.
+*/
+type Record struct {
+	ID       string
+	Name     string
+	Complete bool
+	Revision int64
+	Notes    string
+	Priority int
+
+	CreatedDate  int64
+	ModifiedDate int64
+	DueDate      int64
+	Estimate     int64
+
+	TimeEntries []TimeEntry
+
+	Categories []string
+
+	Recurrence string
+	SeriesID   string
+	Occurrence int
+
+	ParentIDs  []string
+	SubtaskIDs []string
+
+	BlockedByIDs []string
+}
+
+/*
+NewRecord creates the serializable form of a task. The record shares no
+memory with the task, later changes to one don't affect the other.
+*/
+func NewRecord(t *Task) Record {
+	var parentIDs []string
+	for _, parent := range t.Parents {
+		parentIDs = append(parentIDs, parent.ID)
+	}
+
+	var subtaskIDs []string
+	for _, subtask := range t.Subtasks {
+		subtaskIDs = append(subtaskIDs, subtask.ID)
+	}
+
+	var blockedByIDs []string
+	for _, blocker := range t.BlockedBy {
+		blockedByIDs = append(blockedByIDs, blocker.ID)
+	}
+
+	var timeEntries []TimeEntry
+	timeEntries = append(timeEntries, t.TimeEntries...)
+
+	return Record{
+		ID:           t.ID,
+		Name:         t.Name,
+		Complete:     t.Complete,
+		Revision:     t.Revision,
+		Notes:        t.Notes,
+		Priority:     t.Priority,
+		CreatedDate:  t.CreatedDate,
+		ModifiedDate: t.ModifiedDate,
+		DueDate:      t.DueDate,
+		Estimate:     t.Estimate,
+		TimeEntries:  timeEntries,
+		Categories:   copyStrings(t.Categories),
+		Recurrence:   t.Recurrence,
+		SeriesID:     t.SeriesID,
+		Occurrence:   t.Occurrence,
+		ParentIDs:    parentIDs,
+		SubtaskIDs:   subtaskIDs,
+		BlockedByIDs: blockedByIDs,
+	}
+}
+
+/*
+Records returns the serializable form of every task in the tasklist. The
+records are ordered by creation date (then ID), so serializing the same
+tasklist twice gives the same result.
+*/
+func (ts Tasklist) Records() []Record {
+	records := make([]Record, 0, len(ts.Registry))
+	for _, task := range ts.Registry {
+		records = append(records, NewRecord(task))
+	}
+
+	SortRecords(records)
+
+	return records
+}
+
+/*
+SortRecords sorts records by creation date (then ID), the order Records()
+returns them in.
+*/
+func SortRecords(records []Record) {
+	sort.Sort(byCreatedDate(records))
+}
+
+/*
+NewTasklistFromRecords connects serialized tasks back up into a tasklist.
+RootTasks holds the tasks without parents, in the order their records were
+supplied. Edges to tasks which aren't among the records are dropped.
+
+Edges recorded on only one end (as older versions sometimes did) are
+restored on the other end, and edges closing a cycle (of subtasks, of
+blockers, or of both together) are dropped, so the tasklist is always a
+proper graph of tasks and subtasks.
+*/
+func NewTasklistFromRecords(records []Record) Tasklist {
+	tasklist := NewTasklist()
+
+	for _, record := range records {
+		tasklist.Registry[record.ID] = &Task{
+			ID:           record.ID,
+			Name:         record.Name,
+			Complete:     record.Complete,
+			Revision:     record.Revision,
+			Notes:        record.Notes,
+			Priority:     record.Priority,
+			CreatedDate:  record.CreatedDate,
+			ModifiedDate: record.ModifiedDate,
+			DueDate:      record.DueDate,
+			Estimate:     record.Estimate,
+			TimeEntries:  append([]TimeEntry{}, record.TimeEntries...),
+			Categories:   copyStrings(record.Categories),
+			Recurrence:   record.Recurrence,
+			SeriesID:     record.SeriesID,
+			Occurrence:   record.Occurrence,
+			Parents:      []*Task{},
+			Subtasks:     []*Task{},
+		}
+	}
+
+	for _, record := range records {
+		task := tasklist.Registry[record.ID]
+
+		for _, parentID := range record.ParentIDs {
+			if parent, ok := tasklist.Registry[parentID]; ok {
+				task.Parents = append(task.Parents, parent)
+			}
+		}
+
+		for _, subtaskID := range record.SubtaskIDs {
+			if subtask, ok := tasklist.Registry[subtaskID]; ok {
+				task.Subtasks = append(task.Subtasks, subtask)
+			}
+		}
+
+		for _, blockerID := range record.BlockedByIDs {
+			if blocker, ok := tasklist.Registry[blockerID]; ok && findTaskInSlice(task.BlockedBy, blockerID) == -1 {
+				task.BlockedBy = append(task.BlockedBy, blocker)
+				blocker.Blocks = append(blocker.Blocks, task)
+			}
+		}
+	}
+
+	ordered := make([]*Task, 0, len(records))
+	for _, record := range records {
+		task := tasklist.Registry[record.ID]
+		ordered = append(ordered, task)
+
+		for _, parent := range task.Parents {
+			if findTaskInSlice(parent.Subtasks, task.ID) == -1 {
+				parent.Subtasks = append(parent.Subtasks, task)
+			}
+		}
+
+		for _, subtask := range task.Subtasks {
+			if findTaskInSlice(subtask.Parents, task.ID) == -1 {
+				subtask.Parents = append(subtask.Parents, task)
+			}
+		}
+	}
+
+	removeCycles(ordered, func(t *Task) []*Task { return t.Subtasks }, unlinkSubtask)
+	removeCycles(ordered, func(t *Task) []*Task { return t.BlockedBy }, func(t *Task, blocker *Task) {
+		t.RemoveBlocker(blocker)
+	})
+	removeCycles(ordered, (*Task).WaitingOn, func(t *Task, waitedOn *Task) {
+		// The edge closing a cycle through both can be of either kind.
+		if findTaskInSlice(t.BlockedBy, waitedOn.ID) != -1 {
+			t.RemoveBlocker(waitedOn)
+		} else {
+			unlinkSubtask(t, waitedOn)
+		}
+	})
+
+	for _, record := range records {
+		task := tasklist.Registry[record.ID]
+		if task.IsRootTask() && findTaskInSlice(tasklist.RootTasks, task.ID) == -1 {
+			tasklist.RootTasks = append(tasklist.RootTasks, task)
+		}
+	}
+
+	return tasklist
+}
+
+/*
+MarshalJSON serializes the tasklist as a snapshot of its records, in the
+current version of the snapshot format (see EncodeSnapshot).
+*/
+func (ts Tasklist) MarshalJSON() ([]byte, error) {
+	return EncodeSnapshot(ts.Records())
+}
+
+/*
+UnmarshalJSON replaces the contents of the tasklist with the tasks in a
+snapshot written in any version of the format (see DecodeSnapshot).
+*/
+func (ts *Tasklist) UnmarshalJSON(contents []byte) error {
+	records, _, err := DecodeSnapshot(contents)
+	if err != nil {
+		return err
+	}
+
+	*ts = NewTasklistFromRecords(records)
+
+	return nil
+}
+
+type byCreatedDate []Record
+
+func (r byCreatedDate) Len() int      { return len(r) }
+func (r byCreatedDate) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r byCreatedDate) Less(i, j int) bool {
+	if r[i].CreatedDate != r[j].CreatedDate {
+		return r[i].CreatedDate < r[j].CreatedDate
+	}
+
+	return r[i].ID < r[j].ID
+}
+
+/*
+copyStrings copies a slice so records never share memory with the tasks
+they came from. A nil slice stays nil.
+*/
+func copyStrings(strings []string) []string {
+	if strings == nil {
+		return nil
+	}
+
+	copied := make([]string, len(strings))
+	copy(copied, strings)
+
+	return copied
+}
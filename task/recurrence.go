@@ -0,0 +1,301 @@
+package task
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+Frequencies a task can recur at.
+*/
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+)
+
+/*
+weekdayNames holds the RRULE name of each time.Weekday.
+*/
+var weekdayNames = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+/*
+Recurrence is a schedule a task repeats on, written as a subset of an
+RFC 5545 RRULE:
+
+	FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=10
+
+FREQ is DAILY, WEEKLY or MONTHLY, and INTERVAL (default 1) how many of
+those to step each time. BYDAY lists the days of the week a weekly task
+falls on (weeks start on Monday). BYMONTHDAY is the day of the month a
+monthly task falls on, from 1 to 31, or counting back from the end of the
+month, -1 being the last day. A day past the end of a shorter month falls
+on its last day instead. COUNT limits how many occurrences there are in
+all, or UNTIL (a date, 20061231, or UTC time, 20061231T150405Z) the last
+date one can fall on.
+*/
+type Recurrence struct {
+	Frequency  string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay int
+	Count      int
+	Until      int64
+}
+
+/*
+ParseRecurrence reads a recurrence rule, with or without the "RRULE:"
+prefix.
+*/
+func ParseRecurrence(rule string) (Recurrence, error) {
+	recurrence := Recurrence{Interval: 1}
+
+	rule = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(rule)), "RRULE:")
+	if rule == "" {
+		return Recurrence{}, fmt.Errorf("recurrence rule is empty")
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(rule, ";") {
+		nameAndValue := strings.SplitN(part, "=", 2)
+		if len(nameAndValue) != 2 || nameAndValue[1] == "" {
+			return Recurrence{}, fmt.Errorf("'%v' isn't a NAME=VALUE pair", part)
+		}
+
+		name, value := nameAndValue[0], nameAndValue[1]
+		if seen[name] {
+			return Recurrence{}, fmt.Errorf("%v is given more than once", name)
+		}
+		seen[name] = true
+
+		var err error
+		switch name {
+		case "FREQ":
+			if value != Daily && value != Weekly && value != Monthly {
+				err = fmt.Errorf("FREQ must be %v, %v or %v", Daily, Weekly, Monthly)
+			}
+			recurrence.Frequency = value
+		case "INTERVAL":
+			recurrence.Interval, err = parsePositive(name, value)
+		case "COUNT":
+			recurrence.Count, err = parsePositive(name, value)
+		case "UNTIL":
+			recurrence.Until, err = parseUntil(value)
+		case "BYDAY":
+			recurrence.ByDay, err = parseByDay(value)
+		case "BYMONTHDAY":
+			recurrence.ByMonthDay, err = parseByMonthDay(value)
+		default:
+			err = fmt.Errorf("%v isn't supported", name)
+		}
+		if err != nil {
+			return Recurrence{}, err
+		}
+	}
+
+	switch {
+	case recurrence.Frequency == "":
+		return Recurrence{}, fmt.Errorf("FREQ is required")
+	case recurrence.Count > 0 && recurrence.Until > 0:
+		return Recurrence{}, fmt.Errorf("COUNT and UNTIL can't both be given")
+	case len(recurrence.ByDay) > 0 && recurrence.Frequency != Weekly:
+		return Recurrence{}, fmt.Errorf("BYDAY is only supported with FREQ=%v", Weekly)
+	case recurrence.ByMonthDay != 0 && recurrence.Frequency != Monthly:
+		return Recurrence{}, fmt.Errorf("BYMONTHDAY is only supported with FREQ=%v", Monthly)
+	}
+
+	return recurrence, nil
+}
+
+func parsePositive(name string, value string) (int, error) {
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 1 {
+		return 0, fmt.Errorf("%v must be a whole number, 1 or more", name)
+	}
+
+	return parsed, nil
+}
+
+/*
+parseUntil reads an UNTIL date, which includes the whole of the day when
+given without a time.
+*/
+func parseUntil(value string) (int64, error) {
+	if until, err := time.Parse("20060102T150405Z", value); err == nil {
+		return until.Unix(), nil
+	}
+
+	if until, err := time.ParseInLocation("20060102", value, time.Local); err == nil {
+		return until.AddDate(0, 0, 1).Unix() - 1, nil
+	}
+
+	return 0, fmt.Errorf("UNTIL must be a date (20061231) or a UTC time (20061231T150405Z)")
+}
+
+func parseByDay(value string) ([]time.Weekday, error) {
+	days := []time.Weekday{}
+	for _, name := range strings.Split(value, ",") {
+		day := -1
+		for i, weekdayName := range weekdayNames {
+			if name == weekdayName {
+				day = i
+			}
+		}
+
+		if day == -1 {
+			return nil, fmt.Errorf("BYDAY must list days as MO, TU, WE, TH, FR, SA or SU")
+		}
+
+		days = append(days, time.Weekday(day))
+	}
+
+	// Order the days from Monday, the start of the week.
+	sort.Slice(days, func(i, j int) bool {
+		return (days[i]+6)%7 < (days[j]+6)%7
+	})
+
+	return days, nil
+}
+
+func parseByMonthDay(value string) (int, error) {
+	day, err := strconv.Atoi(value)
+	if err != nil || day == 0 || day < -31 || day > 31 {
+		return 0, fmt.Errorf("BYMONTHDAY must be a single day of the month, from 1 to 31 or -1 to -31")
+	}
+
+	return day, nil
+}
+
+/*
+String writes the recurrence as a rule ParseRecurrence reads, in a
+canonical form.
+*/
+func (r Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Frequency}
+
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%v", r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := []string{}
+		for _, day := range r.ByDay {
+			days = append(days, weekdayNames[day])
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	if r.ByMonthDay != 0 {
+		parts = append(parts, fmt.Sprintf("BYMONTHDAY=%v", r.ByMonthDay))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%v", r.Count))
+	}
+
+	if r.Until > 0 {
+		parts = append(parts, "UNTIL="+time.Unix(r.Until, 0).UTC().Format("20060102T150405Z"))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+/*
+Next returns when the occurrence after the one at the given time falls.
+Without BYMONTHDAY, a monthly occurrence keeps to the day of the month of
+the given time, so a series should be anchored (see Anchor) before it's
+stepped through, or it drifts to the 28th after February.
+*/
+func (r Recurrence) Next(after time.Time) time.Time {
+	switch r.Frequency {
+	case Daily:
+		return after.AddDate(0, 0, r.Interval)
+	case Monthly:
+		day := r.ByMonthDay
+		if day == 0 {
+			day = after.Day()
+		}
+		return addMonths(after, r.Interval, day)
+	}
+
+	if len(r.ByDay) == 0 {
+		return after.AddDate(0, 0, 7*r.Interval)
+	}
+
+	weekStart := startOfWeek(after)
+	for days := 1; ; days++ {
+		candidate := after.AddDate(0, 0, days)
+
+		weeks := int(startOfWeek(candidate).Sub(weekStart).Hours()+12) / (7 * 24)
+		if weeks%r.Interval == 0 && r.fallsOn(candidate.Weekday()) {
+			return candidate
+		}
+	}
+}
+
+func (r Recurrence) fallsOn(weekday time.Weekday) bool {
+	for _, day := range r.ByDay {
+		if day == weekday {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+startOfWeek returns midnight on the Monday starting the week of the time.
+*/
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, t.Location())
+}
+
+/*
+Anchor returns the recurrence pinned to the day of the month of the time
+the series starts at, so every occurrence falls on that day, or the last
+day of shorter months. Only monthly recurrences without a BYMONTHDAY
+change, others are returned as they are.
+*/
+func (r Recurrence) Anchor(start time.Time) Recurrence {
+	if r.Frequency == Monthly && r.ByMonthDay == 0 {
+		r.ByMonthDay = start.Day()
+	}
+
+	return r
+}
+
+/*
+addMonths adds months to a time, moving it to the given day of the month
+(counting back from the end of the month if negative). A day past the end
+of a shorter month becomes its last day, so January 31st plus a month is
+February 28th or 29th, rather than early March.
+*/
+func addMonths(t time.Time, months int, day int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+
+	if day < 0 {
+		day = lastDay + 1 + day
+	}
+	if day > lastDay {
+		day = lastDay
+	}
+	if day < 1 {
+		day = 1
+	}
+
+	return firstOfMonth.AddDate(0, 0, day-1)
+}
+
+/*
+Ends returns true if a series with this recurrence ends with the given
+occurrence (counting from 1), which would have been followed by one at the
+given time.
+*/
+func (r Recurrence) Ends(occurrence int, next time.Time) bool {
+	return (r.Count > 0 && occurrence >= r.Count) || (r.Until > 0 && next.Unix() > r.Until)
+}
@@ -0,0 +1,168 @@
+package task
+
+import (
+	"time"
+)
+
+/*
+RollUp sums up the work on a task and everything below it. Estimate and
+TimeSpent are in seconds, and Progress is the percentage of the work done,
+from 0 to 100.
+*/
+type RollUp struct {
+	Progress  int   `json:"progress"`
+	Estimate  int64 `json:"estimate"`
+	TimeSpent int64 `json:"timeSpent"`
+}
+
+/*
+RollUp sums up the estimates and time spent over the task and every task
+below it, see RollUps. Rolling up many tasks at once is quicker with
+RollUps, which shares the work between them.
+*/
+func (t *Task) RollUp(now time.Time) RollUp {
+	return NewRollUps(now).Get(t)
+}
+
+/*
+RollUps sums up the work on tasks and everything below them, all as of the
+same moment. Each task's totals are worked out once, from its subtasks'
+totals, so rolling up every task of a tasklist takes time in proportion to
+the number of tasks. A task reached through more than one parent is only
+counted once, which takes a walk over the subtree of each task above it.
+
+Progress is the share of the work which is complete. Tasks with an
+estimate count for their estimate. Tasks without subtasks or an estimate
+count for the average estimate of the ones which have one, or all count
+the same when none do, so a parent with 9 of its 10 subtasks done is 90%
+of the way there either way. A complete task is always 100% done.
+*/
+type RollUps struct {
+	now time.Time
+
+	totals map[string]rollUpTotals
+
+	/*
+		shared holds the tasks whose subtrees reach a task through more
+		than one path.
+	*/
+	shared map[string]bool
+}
+
+/*
+rollUpTotals are the sums a roll-up is worked out from.
+*/
+type rollUpTotals struct {
+	estimate     int64
+	estimateDone int64
+	timeSpent    int64
+
+	// estimated counts the tasks with an estimate, unestimated the ones
+	// without subtasks or an estimate.
+	estimated       int64
+	unestimated     int64
+	unestimatedDone int64
+}
+
+/*
+NewRollUps returns RollUps counting running timers up to now.
+*/
+func NewRollUps(now time.Time) *RollUps {
+	return &RollUps{
+		now:    now,
+		totals: make(map[string]rollUpTotals),
+		shared: make(map[string]bool),
+	}
+}
+
+/*
+Get returns the roll-up of the task and everything below it.
+*/
+func (r *RollUps) Get(t *Task) RollUp {
+	totals := r.getTotals(t)
+
+	rollUp := RollUp{
+		Estimate:  totals.estimate,
+		TimeSpent: totals.timeSpent,
+	}
+
+	// Unestimated tasks weigh the average estimate, estimate/estimated,
+	// so both sides are multiplied through by estimated.
+	done := totals.estimateDone*totals.estimated + totals.unestimatedDone*totals.estimate
+	all := totals.estimate*totals.estimated + totals.unestimated*totals.estimate
+	if totals.estimated == 0 {
+		done, all = totals.unestimatedDone, totals.unestimated
+	}
+
+	switch {
+	case t.Complete:
+		rollUp.Progress = 100
+	case all > 0:
+		rollUp.Progress = int(done * 100 / all)
+	}
+
+	return rollUp
+}
+
+func (r *RollUps) getTotals(t *Task) rollUpTotals {
+	if totals, ok := r.totals[t.ID]; ok {
+		return totals
+	}
+
+	totals := r.ownTotals(t)
+	for _, subtask := range t.Subtasks {
+		totals.add(r.getTotals(subtask))
+
+		if r.shared[subtask.ID] || len(subtask.Parents) > 1 {
+			r.shared[t.ID] = true
+		}
+	}
+
+	// Summing the subtasks would count a task reached through more than
+	// one of them more than once, so count each task in the subtree
+	// instead.
+	if r.shared[t.ID] {
+		totals = rollUpTotals{}
+		for _, task := range append([]*Task{t}, walk(t, func(t *Task) []*Task { return t.Subtasks })...) {
+			totals.add(r.ownTotals(task))
+		}
+	}
+
+	r.totals[t.ID] = totals
+
+	return totals
+}
+
+/*
+ownTotals are the totals of the task alone, leaving out its subtasks.
+*/
+func (r *RollUps) ownTotals(t *Task) rollUpTotals {
+	totals := rollUpTotals{
+		estimate:  t.Estimate,
+		timeSpent: t.TimeSpent(r.now),
+	}
+
+	switch {
+	case t.Estimate > 0:
+		totals.estimated = 1
+		if t.Complete {
+			totals.estimateDone = t.Estimate
+		}
+	case len(t.Subtasks) == 0:
+		totals.unestimated = 1
+		if t.Complete {
+			totals.unestimatedDone = 1
+		}
+	}
+
+	return totals
+}
+
+func (totals *rollUpTotals) add(other rollUpTotals) {
+	totals.estimate += other.estimate
+	totals.estimateDone += other.estimateDone
+	totals.timeSpent += other.timeSpent
+	totals.estimated += other.estimated
+	totals.unestimated += other.unestimated
+	totals.unestimatedDone += other.unestimatedDone
+}
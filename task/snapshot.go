@@ -0,0 +1,282 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+/*
+CurrentSchemaVersion is the version of the snapshot format written by this
+version of the code, the format of tasklists stored in files by both
+Tasklist.Store and the storage package. Snapshots written in an older
+format are upgraded to it when they are loaded.
+
+	Version 0: The original format. A "Tasks" object maps task IDs to tasks,
+	           each with a single "Parent" ID and a set of "Subtasks" IDs.
+	Version 1: A bare array of Record, with multiple parents per task.
+	Version 2: Version 1 wrapped in an object stamped with its version.
+*/
+const CurrentSchemaVersion = 2
+
+/*
+MigrationReport describes what was (or in a dry run, would be) done to
+bring a storage file up to date.
+*/
+type MigrationReport struct {
+	Filename    string
+	FromVersion int
+	ToVersion   int
+
+	/*
+		Changes lists, in plain english, everything the migrations changed
+		along the way.
+	*/
+	Changes []string
+}
+
+/*
+NeedsMigration returns true if the file was written in an older format.
+*/
+func (r MigrationReport) NeedsMigration() bool {
+	return r.FromVersion < r.ToVersion
+}
+
+/*
+AddChange records a change made by a migration, described in plain
+english.
+*/
+func (r *MigrationReport) AddChange(format string, args ...interface{}) {
+	r.Changes = append(r.Changes, fmt.Sprintf(format, args...))
+}
+
+/*
+snapshotFile is the format of the storage file since version 2.
+*/
+type snapshotFile struct {
+	Version int
+	Tasks   []Record
+}
+
+/*
+migration upgrades the contents of a storage file by a single version.
+*/
+type migration func(contents []byte, report *MigrationReport) ([]byte, error)
+
+/*
+migrations holds every migration, indexed by the version each one upgrades
+from. Bumping CurrentSchemaVersion means appending a migration here.
+*/
+var migrations = []migration{
+	migrateFromLegacyFormat,
+	migrateToVersionedFile,
+}
+
+/*
+EncodeSnapshot writes records out in the current version of the snapshot
+format. This is the format of every tasklist written to a file, whether by
+Tasklist.Store or by the storage package.
+*/
+func EncodeSnapshot(records []Record) ([]byte, error) {
+	if records == nil {
+		records = []Record{}
+	}
+
+	return json.Marshal(snapshotFile{
+		Version: CurrentSchemaVersion,
+		Tasks:   records,
+	})
+}
+
+/*
+DecodeSnapshot decodes the contents of a snapshot written in any known
+version of the format, upgrading it along the way. The report describes
+what the upgrade changed.
+*/
+func DecodeSnapshot(contents []byte) ([]Record, MigrationReport, error) {
+	version, err := detectSchemaVersion(contents)
+	if err != nil {
+		return nil, MigrationReport{}, err
+	}
+
+	report := MigrationReport{
+		FromVersion: version,
+		ToVersion:   CurrentSchemaVersion,
+	}
+
+	if version > CurrentSchemaVersion {
+		return nil, report, fmt.Errorf("storage file is version %v, newer than the supported version %v", version, CurrentSchemaVersion)
+	}
+
+	for ; version < CurrentSchemaVersion; version++ {
+		contents, err = migrations[version](contents, &report)
+		if err != nil {
+			return nil, report, fmt.Errorf("couldn't migrate storage file from version %v (%v)", version, err)
+		}
+	}
+
+	var snapshot snapshotFile
+	if err := json.Unmarshal(contents, &snapshot); err != nil {
+		return nil, report, err
+	}
+
+	if snapshot.Tasks == nil {
+		snapshot.Tasks = []Record{}
+	}
+
+	return snapshot.Tasks, report, nil
+}
+
+/*
+detectSchemaVersion works out which version of the format the contents of a
+storage file are in. Versions before 2 weren't stamped, so they are told
+apart by their shape.
+*/
+func detectSchemaVersion(contents []byte) (int, error) {
+	var array []json.RawMessage
+	if err := json.Unmarshal(contents, &array); err == nil {
+		return 1, nil
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(contents, &object); err != nil {
+		return 0, errors.New("storage file is neither a json array nor a json object")
+	}
+
+	if rawVersion, ok := object["Version"]; ok {
+		var version int
+		if err := json.Unmarshal(rawVersion, &version); err != nil {
+			return 0, fmt.Errorf("storage file has an invalid version (%v)", err)
+		}
+
+		return version, nil
+	}
+
+	if _, ok := object["Tasks"]; ok {
+		return 0, nil
+	}
+
+	return 0, errors.New("storage file is in an unrecognized format")
+}
+
+/*
+legacyTask is a task as stored in version 0 of the format.
+*/
+type legacyTask struct {
+	ID       string
+	Name     string
+	Complete bool
+	Parent   string
+	Subtasks map[string]bool
+}
+
+/*
+migrateFromLegacyFormat converts version 0 to version 1. Version 0 recorded
+edges from both ends, a single Parent on the subtask and a set of Subtasks
+on the parent, and the two didn't always agree. Every edge which can be
+followed to an existing task on either end is kept, anything else is
+dropped and reported.
+*/
+func migrateFromLegacyFormat(contents []byte, report *MigrationReport) ([]byte, error) {
+	var legacy struct {
+		Tasks map[string]legacyTask
+	}
+	if err := json.Unmarshal(contents, &legacy); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(legacy.Tasks))
+	for id := range legacy.Tasks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	tasks := make(map[string]*Record, len(ids))
+	for _, id := range ids {
+		legacyTask := legacy.Tasks[id]
+		tasks[id] = &Record{
+			ID:         id,
+			Name:       legacyTask.Name,
+			Complete:   legacyTask.Complete,
+			Categories: []string{},
+		}
+	}
+
+	addEdge := func(parentID string, subtaskID string) {
+		parent, subtask := tasks[parentID], tasks[subtaskID]
+		if findString(parent.SubtaskIDs, subtaskID) == -1 {
+			parent.SubtaskIDs = append(parent.SubtaskIDs, subtaskID)
+		}
+		if findString(subtask.ParentIDs, parentID) == -1 {
+			subtask.ParentIDs = append(subtask.ParentIDs, parentID)
+		}
+	}
+
+	for _, id := range ids {
+		legacyTask := legacy.Tasks[id]
+
+		subtaskIDs := make([]string, 0, len(legacyTask.Subtasks))
+		for subtaskID := range legacyTask.Subtasks {
+			subtaskIDs = append(subtaskIDs, subtaskID)
+		}
+		sort.Strings(subtaskIDs)
+
+		for _, subtaskID := range subtaskIDs {
+			if _, ok := tasks[subtaskID]; !ok {
+				report.AddChange("Dropped subtask '%v' of task '%v', no such task exists", subtaskID, id)
+				continue
+			}
+
+			addEdge(id, subtaskID)
+		}
+
+		if legacyTask.Parent == "" {
+			continue
+		}
+
+		if _, ok := tasks[legacyTask.Parent]; !ok {
+			report.AddChange("Dropped parent '%v' of task '%v', no such task exists", legacyTask.Parent, id)
+			continue
+		}
+
+		addEdge(legacyTask.Parent, id)
+	}
+
+	migrated := make([]Record, 0, len(ids))
+	for _, id := range ids {
+		migrated = append(migrated, *tasks[id])
+	}
+
+	report.AddChange("Converted %v tasks from the legacy format", len(migrated))
+
+	return json.Marshal(migrated)
+}
+
+/*
+migrateToVersionedFile converts version 1 to version 2 by wrapping the
+tasks in an object stamped with the version.
+*/
+func migrateToVersionedFile(contents []byte, report *MigrationReport) ([]byte, error) {
+	var tasks []Record
+	if err := json.Unmarshal(contents, &tasks); err != nil {
+		return nil, err
+	}
+
+	report.AddChange("Stamped the storage file with its schema version")
+
+	return json.Marshal(snapshotFile{
+		Version: 2,
+		Tasks:   tasks,
+	})
+}
+
+func findString(strings []string, s string) int {
+	for i, candidate := range strings {
+		if candidate == s {
+			return i
+		}
+	}
+
+	return -1
+}
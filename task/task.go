@@ -18,18 +18,79 @@ A task with no parents is called a "root" task.
 type Task struct {
 	ID       string `json:"id"`
 	Name     string `json:"name"`
-	Complete bool   `json:complete`
+	Complete bool   `json:"complete"`
+
+	/*
+		Notes holds any free-form text about the task beyond its name.
+	*/
+	Notes string `json:"notes"`
+
+	/*
+		Priority says how important the task is, from PriorityNone up to
+		PriorityHigh.
+	*/
+	Priority int `json:"priority"`
+
+	/*
+		Revision is bumped every time the task is stored with changes, so
+		clients can tell whether the copy they have is still current.
+	*/
+	Revision int64 `json:"revision"`
 
 	CreatedDate  int64 `json:"createdDate"`
 	ModifiedDate int64 `json:"modifiedDate"`
 	DueDate      int64 `json:"dueDate"`
 
+	/*
+		Estimate is how long the task is expected to take, in seconds, or 0
+		if nobody has said.
+	*/
+	Estimate int64 `json:"estimate"`
+
+	/*
+		TimeEntries logs the time spent working on the task, oldest first.
+		Only the last entry can still be running.
+	*/
+	TimeEntries []TimeEntry `json:"timeEntries"`
+
 	Categories []string `json:"categories"`
 
+	/*
+		Recurrence is the rule (see Recurrence) the task repeats on, or
+		empty if it doesn't. Completing a recurring task creates the next
+		occurrence in its series.
+	*/
+	Recurrence string `json:"recurrence"`
+
+	/*
+		SeriesID is the ID of the first occurrence of a recurring task,
+		shared by every occurrence since, and Occurrence counts them from 1.
+		Both are left empty until a task first recurs.
+	*/
+	SeriesID   string `json:"seriesID"`
+	Occurrence int    `json:"occurrence"`
+
 	Parents  []*Task `json:"-"`
 	Subtasks []*Task `json:"subtasks"`
+
+	/*
+		BlockedBy holds the tasks which have to be done before this one can
+		be, and Blocks the tasks waiting on this one.
+	*/
+	BlockedBy []*Task `json:"-"`
+	Blocks    []*Task `json:"-"`
 }
 
+/*
+Priorities a task can have. Higher priorities are more important.
+*/
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
 /*
 NewTask creates a new task with the assigned parents. The new task is in an
 incomplete state, with no subtasks of it's own. Passing in nil or an empty
@@ -51,6 +112,7 @@ func NewTask(name string, parents []*Task) *Task {
 		ModifiedDate: now,
 		DueDate:      0,
 		Categories:   make([]string, 0),
+		TimeEntries:  make([]TimeEntry, 0),
 		Parents:      parents,
 		Subtasks:     make([]*Task, 0),
 	}
@@ -70,6 +132,14 @@ func (t Task) IsRootTask() bool {
 	return len(t.Parents) == 0
 }
 
+/*
+HasParent returns true if the task with the supplied ID is one of the
+task's parents.
+*/
+func (t Task) HasParent(parentID string) bool {
+	return findTaskInSlice(t.Parents, parentID) != -1
+}
+
 /*
 MarkAsComplete marks a task and all of it's subtasks as complete.
 It the task itself is a subtask of a parent task and the task was
@@ -126,13 +196,22 @@ func (t *Task) SetComplete(complete bool) {
 }
 
 /*
-AddSubtask adds a subtask to a task. If the subtask is incomplete,
-the task will be marked as incomplete as well. If the provided task
-is already a listed subtask, nothing happens.
+AddSubtask adds a subtask to a task, and the task to the subtask's parents.
+If the subtask is incomplete, the task will be marked as incomplete as well.
+If the provided task is already a listed subtask, nothing happens.
+
+A task can't be its own ancestor, or wait on itself through its blockers.
+If the subtask is the task itself, one of its ancestors, or already waiting
+on the task (see WaitingOn), a CycleError is returned and nothing is
+changed.
 */
-func (t *Task) AddSubtask(subtask *Task) {
+func (t *Task) AddSubtask(subtask *Task) error {
 	if findTaskInSlice(t.Subtasks, subtask.ID) != -1 {
-		return
+		return nil
+	}
+
+	if subtask.ID == t.ID || isWaitingOn(subtask, t) {
+		return NewCycleError(t.ID, subtask.ID)
 	}
 
 	if t.Complete && !subtask.Complete {
@@ -140,24 +219,54 @@ func (t *Task) AddSubtask(subtask *Task) {
 	}
 
 	t.Subtasks = append(t.Subtasks, subtask)
+
+	if findTaskInSlice(subtask.Parents, t.ID) == -1 {
+		subtask.Parents = append(subtask.Parents, t)
+	}
+
+	return nil
 }
 
 /*
 AddParent adds a parent to a task. If the task is incomplete, it marks
 the new parent as incomplete as well. If the parent is already included
-in the list of parents, nothing happens.
+in the list of parents, nothing happens. Just like AddSubtask(), a
+CycleError is returned if the parent is the task itself or one of its
+descendants.
+*/
+func (t *Task) AddParent(parent *Task) error {
+	return parent.AddSubtask(t)
+}
+
+/*
+RemoveSubtask removes a subtask from a task, and the task from the
+subtask's parents. The subtask itself is left alone, if it has no other
+parents it becomes a root task.
+
+If the subtask was the only thing left keeping the task from being
+complete, the task is marked as complete, just as if the subtask had been
+completed. A task left with no subtasks at all keeps its completion as it
+is. If the provided task isn't a listed subtask, nothing happens.
 */
-func (t *Task) AddParent(parent *Task) {
-	if findTaskInSlice(t.Parents, parent.ID) != -1 {
+func (t *Task) RemoveSubtask(subtask *Task) {
+	if findTaskInSlice(t.Subtasks, subtask.ID) == -1 {
 		return
 	}
 
-	if !t.Complete && parent.Complete {
-		parent.MarkAsIncomplete()
+	t.Subtasks = deleteFromSliceByID(t.Subtasks, subtask.ID)
+	subtask.Parents = deleteFromSliceByID(subtask.Parents, t.ID)
+
+	if !t.Complete && len(t.Subtasks) > 0 && t.allSubtasksAreComplete() {
+		t.MarkAsComplete()
 	}
+}
 
-	t.Parents = append(t.Parents, parent)
-	parent.AddSubtask(t)
+/*
+RemoveParent removes a parent from a task. It works just like the parent
+removing the task from its subtasks.
+*/
+func (t *Task) RemoveParent(parent *Task) {
+	parent.RemoveSubtask(t)
 }
 
 /*
@@ -168,7 +277,11 @@ if they have no remaining incomplete subtasks.
 func (t *Task) Delete() {
 	t.MarkAsComplete()
 
-	for _, subtask := range t.Subtasks {
+	// Deleting a subtask removes it from t.Subtasks, so work from a copy.
+	subtasks := make([]*Task, len(t.Subtasks))
+	copy(subtasks, t.Subtasks)
+
+	for _, subtask := range subtasks {
 		subtask.Delete()
 	}
 
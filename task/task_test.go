@@ -1,7 +1,13 @@
 package task
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestIsRootTask(t *testing.T) {
@@ -11,6 +17,22 @@ func TestIsRootTask(t *testing.T) {
 	}
 }
 
+func TestHasParentAndIsBlockedBy(t *testing.T) {
+	tasklist := NewTasklist()
+	parent, _ := tasklist.CreateTask("parent", nil)
+	other, _ := tasklist.CreateTask("other", nil)
+	child, _ := tasklist.CreateTask("child", []string{parent.ID})
+
+	if !child.HasParent(parent.ID) || child.HasParent(other.ID) || parent.HasParent(child.ID) {
+		t.Error("Expected child to have only parent as a parent")
+	}
+
+	child.AddBlocker(other)
+	if !child.IsBlockedBy(other.ID) || child.IsBlockedBy(parent.ID) {
+		t.Error("Expected child to be blocked by other only")
+	}
+}
+
 func TestMarkAsComplete1(t *testing.T) {
 	root := NewTask("root", nil)
 
@@ -69,3 +91,774 @@ func TestMarkAsComplete3(t *testing.T) {
 		t.Fatal("Root task should be complete, all subtasks are complete")
 	}
 }
+
+func TestTasklistDeleteRemovesSubtasks(t *testing.T) {
+	tasklist := NewTasklist()
+	root := tasklist.AddTask("root", nil)
+	child := tasklist.AddTask("child", []*Task{root})
+	tasklist.AddTask("grandchild1", []*Task{child})
+	tasklist.AddTask("grandchild2", []*Task{child})
+	other := tasklist.AddTask("other", nil)
+
+	tasklist.Delete(root)
+
+	if len(tasklist.Registry) != 1 || tasklist.Registry[other.ID] == nil {
+		t.Fatalf("Only the unrelated task should remain, %v tasks left", len(tasklist.Registry))
+	}
+
+	if len(tasklist.RootTasks) != 1 || tasklist.RootTasks[0] != other {
+		t.Fatal("Deleted root should no longer be a root task")
+	}
+}
+
+func buildDiamond() (Tasklist, *Task) {
+	tasklist := NewTasklist()
+	root := tasklist.AddTask("root", nil)
+	left := tasklist.AddTask("left", []*Task{root})
+	right := tasklist.AddTask("right", []*Task{root})
+	shared := tasklist.AddTask("shared", []*Task{left, right})
+	tasklist.AddTask("leaf", []*Task{shared})
+	tasklist.AddTask("other root", nil)
+
+	shared.Categories = []string{"home", "chores"}
+	shared.DueDate = 1234
+
+	return tasklist, shared
+}
+
+func assertSameGraph(t *testing.T, expected Tasklist, actual Tasklist) {
+	if !reflect.DeepEqual(expected.Records(), actual.Records()) {
+		t.Fatalf("Tasks differ after round trip\nexpected %+v\nactual   %+v", expected.Records(), actual.Records())
+	}
+
+	if len(expected.RootTasks) != len(actual.RootTasks) {
+		t.Fatalf("Expected %v root tasks, got %v", len(expected.RootTasks), len(actual.RootTasks))
+	}
+
+	for _, root := range expected.RootTasks {
+		if findTaskInSlice(actual.RootTasks, root.ID) == -1 {
+			t.Fatalf("Root task '%v' is missing after round trip", root.Name)
+		}
+	}
+
+	for _, task := range actual.Registry {
+		for _, parent := range task.Parents {
+			if actual.Registry[parent.ID] != parent {
+				t.Fatalf("Parent of '%v' isn't the registered task", task.Name)
+			}
+		}
+		for _, subtask := range task.Subtasks {
+			if actual.Registry[subtask.ID] != subtask {
+				t.Fatalf("Subtask of '%v' isn't the registered task", task.Name)
+			}
+		}
+	}
+}
+
+func TestJSONRoundTripPreservesGraph(t *testing.T) {
+	tasklist, shared := buildDiamond()
+
+	contents, err := json.Marshal(tasklist)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var restored Tasklist
+	if err := json.Unmarshal(contents, &restored); err != nil {
+		t.Fatal(err)
+	}
+
+	assertSameGraph(t, tasklist, restored)
+
+	if len(restored.Registry[shared.ID].Parents) != 2 {
+		t.Fatal("Task with two parents should still have both after round trip")
+	}
+}
+
+func TestStoreRestoreRoundTrip(t *testing.T) {
+	file, err := ioutil.TempFile("", "tasklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	tasklist, _ := buildDiamond()
+
+	if err := tasklist.Store(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := NewTasklist()
+	if err := restored.Restore(file.Name()); err != nil {
+		t.Fatal(err)
+	}
+
+	assertSameGraph(t, tasklist, restored)
+}
+
+func TestAddSubtaskSetsParents(t *testing.T) {
+	parent := NewTask("parent", nil)
+	subtask := NewTask("subtask", nil)
+
+	parent.AddSubtask(subtask)
+
+	if findTaskInSlice(subtask.Parents, parent.ID) == -1 || subtask.IsRootTask() {
+		t.Fatal("Adding a subtask should add the parent to the subtask's parents")
+	}
+}
+
+func TestTasklistMove(t *testing.T) {
+	tasklist := NewTasklist()
+	from := tasklist.AddTask("from", nil)
+	to := tasklist.AddTask("to", nil)
+	moving := tasklist.AddTask("moving", []*Task{from})
+	done := tasklist.AddTask("done", []*Task{from})
+	done.MarkAsComplete()
+
+	to.MarkAsComplete()
+
+	tasklist.Move(moving, from, to)
+
+	if !from.Complete {
+		t.Error("Moving away the only incomplete subtask should complete the old parent")
+	}
+	if to.Complete {
+		t.Error("Moving in an incomplete subtask should mark the new parent incomplete")
+	}
+	if findTaskInSlice(moving.Parents, from.ID) != -1 || findTaskInSlice(moving.Parents, to.ID) == -1 {
+		t.Errorf("Moved task should only have the new parent, has %v parents", len(moving.Parents))
+	}
+
+	tasklist.Move(moving, to, nil)
+
+	if !moving.IsRootTask() || findTaskInSlice(tasklist.RootTasks, moving.ID) == -1 {
+		t.Error("Moving a task out from its only parent should make it a root task")
+	}
+	if to.Complete {
+		t.Error("A task left with no subtasks should keep its completion")
+	}
+
+	tasklist.Move(moving, nil, from)
+
+	if findTaskInSlice(tasklist.RootTasks, moving.ID) != -1 {
+		t.Error("Moving a root task under a parent should take it out of the root tasks")
+	}
+}
+
+func TestLinkRejectsCycles(t *testing.T) {
+	tasklist := NewTasklist()
+	root := tasklist.AddTask("root", nil)
+	child := tasklist.AddTask("child", []*Task{root})
+	grandchild := tasklist.AddTask("grandchild", []*Task{child})
+
+	if err := tasklist.Link(grandchild, root); err == nil {
+		t.Fatal("Making a task a subtask of its own descendant should fail")
+	} else if _, ok := err.(CycleError); !ok {
+		t.Fatalf("Expected a CycleError, got %T", err)
+	}
+
+	if err := child.AddParent(child); err == nil {
+		t.Fatal("Making a task its own parent should fail")
+	}
+
+	if len(root.Parents) != 0 || findTaskInSlice(tasklist.RootTasks, root.ID) == -1 {
+		t.Fatal("A refused link should leave the tasks as they were")
+	}
+
+	if !tasklist.IsAncestor(root, grandchild) || tasklist.IsAncestor(grandchild, root) {
+		t.Fatal("Root should be an ancestor of grandchild, and not the other way around")
+	}
+
+	ancestors := tasklist.Ancestors(grandchild)
+	if len(ancestors) != 2 || ancestors[0] != child || ancestors[1] != root {
+		t.Fatalf("Expected grandchild's ancestors to be child then root, got %v tasks", len(ancestors))
+	}
+
+	if descendants := tasklist.Descendants(root); len(descendants) != 2 {
+		t.Fatalf("Expected root to have 2 descendants, got %v", len(descendants))
+	}
+}
+
+func TestNewTasklistFromRecordsDropsCycles(t *testing.T) {
+	records := []Record{
+		{ID: "a", Name: "a", SubtaskIDs: []string{"b"}},
+		{ID: "b", Name: "b", ParentIDs: []string{"a"}, SubtaskIDs: []string{"a"}},
+	}
+
+	tasklist := NewTasklistFromRecords(records)
+
+	a, b := tasklist.Registry["a"], tasklist.Registry["b"]
+	if len(a.Parents) != 0 || len(b.Subtasks) != 0 {
+		t.Fatal("The edge closing the cycle should have been dropped")
+	}
+	if len(tasklist.RootTasks) != 1 || tasklist.RootTasks[0] != a {
+		t.Fatal("Dropping the cycle should leave a as the only root task")
+	}
+
+	// Deleting would recurse forever if the cycle were still there.
+	tasklist.Delete(a)
+}
+
+func TestCreateTaskErrors(t *testing.T) {
+	tasklist := NewTasklist()
+
+	if _, err := tasklist.CreateTask("", nil); err == nil {
+		t.Fatal("Creating a task without a name should fail")
+	} else if createErr, ok := err.(UnableToCreateTaskError); !ok || createErr.Field() != "name" {
+		t.Fatalf("Expected an UnableToCreateTaskError about the name, got %v", err)
+	}
+
+	if _, err := tasklist.CreateTask("orphan", []string{"missing"}); err == nil {
+		t.Fatal("Creating a task under a missing parent should fail")
+	} else if createErr, ok := err.(UnableToCreateTaskError); !ok || createErr.Field() != "parentIDs" {
+		t.Fatalf("Expected an UnableToCreateTaskError about the parents, got %v", err)
+	}
+
+	if len(tasklist.Registry) != 0 {
+		t.Fatal("Failing to create a task shouldn't add anything to the tasklist")
+	}
+
+	if _, err := tasklist.Get("missing"); err == nil {
+		t.Fatal("Getting a missing task should fail")
+	} else if notFoundErr, ok := err.(NotFoundError); !ok || notFoundErr.TaskID() != "missing" {
+		t.Fatalf("Expected a NotFoundError, got %v", err)
+	}
+}
+
+func TestValidationListsEveryViolation(t *testing.T) {
+	fields := Fields{
+		Name:       "  ",
+		DueDate:    -1,
+		Categories: []string{" Home", "home", "", strings.Repeat("x", MaxCategoryLength+1)},
+	}
+
+	fields.Normalize()
+
+	if len(fields.Categories) != 2 || fields.Categories[0] != "home" {
+		t.Fatalf("Expected categories to be trimmed, lower cased and deduplicated, got %q", fields.Categories)
+	}
+
+	err := fields.Validate()
+	validationErr, ok := err.(ValidationError)
+	if !ok {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	violated := make(map[string]bool)
+	for _, violation := range validationErr.Violations {
+		violated[violation.Field] = true
+	}
+
+	if len(validationErr.Violations) != 3 || !violated["name"] || !violated["dueDate"] || !violated["categories"] {
+		t.Fatalf("Expected name, dueDate and categories violations, got %+v", validationErr.Violations)
+	}
+
+	valid := Fields{Name: "write tests", DueDate: 1500000000}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected valid fields to pass, got %v", err)
+	}
+}
+
+func TestFilterAndOrdering(t *testing.T) {
+	tasks := []*Task{
+		{ID: "c", Name: "Call mom", CreatedDate: 300, DueDate: 0, Categories: []string{"home"}},
+		{ID: "a", Name: "Buy milk", CreatedDate: 100, DueDate: 2000, Complete: true},
+		{ID: "b", Name: "buy bread", CreatedDate: 100, DueDate: 1000, Categories: []string{"home"}},
+	}
+
+	incomplete := false
+	filter := Filter{Complete: &incomplete, NameContains: "BUY"}
+
+	matches := []string{}
+	for _, task := range tasks {
+		if filter.Matches(task) {
+			matches = append(matches, task.ID)
+		}
+	}
+	if strings.Join(matches, ",") != "b" {
+		t.Fatalf("Expected only b to match, got %v", matches)
+	}
+
+	if (Filter{DueBefore: 5000}).Matches(tasks[0]) {
+		t.Fatalf("Expected a task without a due date not to match a due date range")
+	}
+
+	orderings := map[string]string{
+		"":             "a,b,c",
+		"-createdDate": "c,b,a",
+		"dueDate":      "b,a,c",
+		"name":         "b,a,c",
+	}
+	for sortBy, expected := range orderings {
+		ordering, err := ParseOrdering(sortBy)
+		if err != nil {
+			t.Fatalf("Couldn't parse ordering %q (%v)", sortBy, err)
+		}
+
+		ordering.Sort(tasks)
+
+		ids := []string{}
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+		if strings.Join(ids, ",") != expected {
+			t.Errorf("Expected sort=%v to give %v, got %v", sortBy, expected, ids)
+		}
+	}
+
+	if _, err := ParseOrdering("color"); err == nil {
+		t.Fatalf("Expected an unknown sort field to be rejected")
+	}
+}
+
+func TestNextActions(t *testing.T) {
+	tasklist := NewTasklist()
+
+	project, _ := tasklist.CreateTask("Project", nil)
+	done, _ := tasklist.CreateTask("Done", []string{project.ID})
+	urgent, _ := tasklist.CreateTask("Urgent", []string{project.ID})
+	dueSoon, _ := tasklist.CreateTask("Due soon", nil)
+	dueLater, _ := tasklist.CreateTask("Due later", nil)
+	someday, _ := tasklist.CreateTask("Someday", nil)
+
+	done.MarkAsComplete()
+	urgent.Priority = PriorityHigh
+	dueSoon.DueDate = 1000
+	dueLater.DueDate = 2000
+	someday.CreatedDate = 0
+
+	names := []string{}
+	for _, action := range tasklist.NextActions() {
+		names = append(names, action.Name)
+	}
+
+	if strings.Join(names, ",") != "Urgent,Due soon,Due later,Someday" {
+		t.Fatalf("Expected leaf tasks ranked by priority, due date and age, got %v", names)
+	}
+}
+
+func TestRecurrence(t *testing.T) {
+	rule, err := ParseRecurrence("rrule:freq=weekly;byday=th,mo;interval=2;count=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rule.String() != "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=3" {
+		t.Fatalf("Expected a canonical rule, got %v", rule)
+	}
+
+	// Monday, then Thursday the same week, then Monday two weeks on.
+	monday := time.Date(2026, time.October, 5, 9, 0, 0, 0, time.UTC)
+	thursday := rule.Next(monday)
+	if !thursday.Equal(monday.AddDate(0, 0, 3)) {
+		t.Fatalf("Expected Thursday, got %v", thursday)
+	}
+	if next := rule.Next(thursday); !next.Equal(monday.AddDate(0, 0, 14)) {
+		t.Fatalf("Expected Monday in two weeks, got %v", next)
+	}
+
+	monthly, _ := ParseRecurrence("FREQ=MONTHLY")
+	if next := monthly.Next(time.Date(2027, time.January, 31, 0, 0, 0, 0, time.UTC)); next.Day() != 28 {
+		t.Fatalf("Expected the last day of February, got %v", next)
+	}
+
+	lastDay, _ := ParseRecurrence("FREQ=MONTHLY;BYMONTHDAY=-1")
+	if next := lastDay.Next(time.Date(2027, time.February, 28, 0, 0, 0, 0, time.UTC)); next.Day() != 31 {
+		t.Fatalf("Expected the last day of March, got %v", next)
+	}
+
+	for _, bad := range []string{"", "FREQ=YEARLY", "FREQ=DAILY;BYDAY=MO", "FREQ=WEEKLY;BYMONTHDAY=1", "FREQ=MONTHLY;BYMONTHDAY=32", "FREQ=MONTHLY;BYMONTHDAY=1,2", "FREQ=DAILY;COUNT=2;UNTIL=20270101", "FREQ=DAILY;INTERVAL=0"} {
+		if _, err := ParseRecurrence(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
+
+func TestMonthlySeriesKeepsToItsDay(t *testing.T) {
+	tasklist := NewTasklist()
+
+	report, _ := tasklist.CreateTask("Monthly report", nil)
+	report.Recurrence = "FREQ=MONTHLY"
+	report.DueDate = time.Date(2027, time.January, 31, 17, 0, 0, 0, time.Local).Unix()
+
+	days := []string{}
+	for i := 0; i < 3; i++ {
+		next, err := tasklist.NextOccurrence(report, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		days = append(days, time.Unix(next.DueDate, 0).Format("Jan 2"))
+		report = next
+	}
+
+	if got := strings.Join(days, ","); got != "Feb 28,Mar 31,Apr 30" {
+		t.Fatalf("Expected the series to keep to the end of the month, got %v", got)
+	}
+
+	if report.Recurrence != "FREQ=MONTHLY;BYMONTHDAY=31" {
+		t.Errorf("Expected the series to be anchored to the 31st, got %v", report.Recurrence)
+	}
+}
+
+func TestCompletingRecurringTaskCreatesNextOccurrence(t *testing.T) {
+	tasklist := NewTasklist()
+
+	chores, _ := tasklist.CreateTask("Chores", nil)
+	tasklist.CreateTask("Dishes", []string{chores.ID})
+	laundry, _ := tasklist.CreateTask("Laundry", []string{chores.ID})
+	wash, _ := tasklist.CreateTask("Wash", []string{laundry.ID})
+	dry, _ := tasklist.CreateTask("Dry", []string{laundry.ID})
+
+	laundry.Recurrence = "FREQ=DAILY;INTERVAL=7;COUNT=2"
+	laundry.DueDate = 1000
+	dry.DueDate = 900
+
+	for occurrence := 2; occurrence <= 3; occurrence++ {
+		tasklist.Recur(func() error {
+			laundry.MarkAsComplete()
+			return nil
+		})
+
+		var next *Task
+		for _, subtask := range chores.Subtasks {
+			if !subtask.Complete && subtask.Name == "Laundry" {
+				next = subtask
+			}
+		}
+
+		if occurrence == 3 {
+			if next != nil {
+				t.Fatalf("Expected the series to end after COUNT occurrences")
+			}
+			break
+		}
+
+		if next == nil || next.SeriesID != laundry.ID || next.Occurrence != occurrence || next.DueDate != 1000+7*24*60*60 {
+			t.Fatalf("Expected the next occurrence, due a week later, got %+v", next)
+		}
+
+		if chores.Complete || len(next.Subtasks) != 2 || next.Subtasks[1].DueDate != 900+7*24*60*60 || next.Subtasks[0].Complete {
+			t.Fatalf("Expected the subtasks to be cloned incomplete with shifted due dates")
+		}
+
+		laundry = next
+	}
+
+	if wash.Complete != true || len(tasklist.Registry) != 8 {
+		t.Fatalf("Expected one cloned occurrence, got %v tasks", len(tasklist.Registry))
+	}
+}
+
+func TestRecurringSubtaskCompletingParents(t *testing.T) {
+	daily := "FREQ=DAILY"
+
+	// Completing the only recurring subtask completes the parent, which
+	// stays complete rather than being reopened by the next occurrence.
+	tasklist := NewTasklist()
+	project, _ := tasklist.CreateTask("Project", nil)
+	standup, _ := tasklist.CreateTask("Standup", []string{project.ID})
+	standup.Recurrence = daily
+
+	tasklist.Recur(func() error {
+		standup.MarkAsComplete()
+		return nil
+	})
+
+	if !project.Complete || len(project.Subtasks) != 1 || len(tasklist.Registry) != 2 {
+		t.Errorf("Expected the project to stay complete without a new occurrence, got complete=%v with %v subtasks", project.Complete, len(project.Subtasks))
+	}
+	if progress := project.RollUp(time.Now()).Progress; progress != 100 {
+		t.Errorf("Expected the project to be 100%% done, got %v%%", progress)
+	}
+
+	// A parent left incomplete still gets the next occurrence, but one
+	// which was completed doesn't.
+	tasklist = NewTasklist()
+	open, _ := tasklist.CreateTask("Open", nil)
+	tasklist.CreateTask("Other work", []string{open.ID})
+	closing, _ := tasklist.CreateTask("Closing", nil)
+	standup, _ = tasklist.CreateTask("Standup", []string{open.ID, closing.ID})
+	standup.Recurrence = daily
+
+	tasklist.Recur(func() error {
+		standup.MarkAsComplete()
+		return nil
+	})
+
+	if open.Complete || len(open.Subtasks) != 3 || !closing.Complete || len(closing.Subtasks) != 1 {
+		t.Errorf("Expected the next occurrence under the open parent only, open has %v subtasks, closing has %v", len(open.Subtasks), len(closing.Subtasks))
+	}
+	if next := open.Subtasks[2]; next.Complete || next.SeriesID != standup.ID || len(next.Parents) != 1 {
+		t.Errorf("Expected the next occurrence to have only the open parent, got %+v", next)
+	}
+
+	// A recurring parent completed by its recurring subtask carries the
+	// subtask on in its own next occurrence, exactly once, whichever of the
+	// two recurs first.
+	for _, subtaskFirst := range []bool{false, true} {
+		tasklist = NewTasklist()
+		review, _ := tasklist.CreateTask("Review", nil)
+		standup, _ = tasklist.CreateTask("Standup", []string{review.ID})
+		review.Recurrence = "FREQ=WEEKLY"
+		standup.Recurrence = daily
+
+		if subtaskFirst {
+			standup.CreatedDate = review.CreatedDate - 1
+		}
+
+		tasklist.Recur(func() error {
+			standup.MarkAsComplete()
+			return nil
+		})
+
+		if !review.Complete || len(review.Subtasks) != 1 || len(tasklist.RootTasks) != 2 {
+			t.Fatalf("Expected the old review to stay complete beside its next occurrence, got %v root tasks", len(tasklist.RootTasks))
+		}
+
+		next := tasklist.RootTasks[1]
+		if next.Complete || next.SeriesID != review.ID || len(next.Subtasks) != 1 {
+			t.Fatalf("Expected the next review with a single subtask, got %+v", next)
+		}
+		if subtask := next.Subtasks[0]; subtask.Complete || subtask.Recurrence != daily || subtask.Name != "Standup" {
+			t.Errorf("Expected the next review's standup to be incomplete and still recur, got %+v", subtask)
+		}
+		if len(tasklist.Registry) != 4 {
+			t.Errorf("Expected just the two old tasks and their two copies, got %v tasks", len(tasklist.Registry))
+		}
+	}
+
+	// Deleting the last subtask completes a recurring parent, which recurs.
+	tasklist = NewTasklist()
+	chore, _ := tasklist.CreateTask("Chore", nil)
+	step, _ := tasklist.CreateTask("Step", []string{chore.ID})
+	chore.Recurrence = daily
+
+	tasklist.Recur(func() error {
+		tasklist.Delete(step)
+		return nil
+	})
+
+	if !chore.Complete || len(tasklist.RootTasks) != 2 || tasklist.RootTasks[1].SeriesID != chore.ID {
+		t.Errorf("Expected deleting the last step to complete the chore and create its next occurrence")
+	}
+}
+
+func TestDependencies(t *testing.T) {
+	tasklist := NewTasklist()
+
+	design, _ := tasklist.CreateTask("Design", nil)
+	build, _ := tasklist.CreateTask("Build", nil)
+	release, _ := tasklist.CreateTask("Release", nil)
+	notes, _ := tasklist.CreateTask("Release notes", []string{release.ID})
+
+	if err := build.AddBlocker(design); err != nil {
+		t.Fatal(err)
+	}
+	if err := notes.AddBlocker(build); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := design.AddBlocker(notes).(DependencyCycleError); !ok {
+		t.Fatalf("Expected a DependencyCycleError for a task waiting on itself")
+	}
+
+	if !build.IsBlocked() || design.IsBlocked() {
+		t.Fatalf("Expected only build to be blocked")
+	}
+
+	if blockers := release.OutstandingBlockers(); len(blockers) != 1 || blockers[0].ID != build.ID {
+		t.Fatalf("Expected release to be held up by build through its subtask, got %v", blockers)
+	}
+
+	next := []string{}
+	for _, action := range tasklist.NextActions() {
+		next = append(next, action.Name)
+	}
+	if strings.Join(next, ",") != "Design" {
+		t.Fatalf("Expected blocked tasks to be left out of next actions, got %v", next)
+	}
+
+	restored := NewTasklistFromRecords(tasklist.Records())
+	if restored.Registry[notes.ID].BlockedBy[0].ID != build.ID || len(restored.Registry[build.ID].Blocks) != 1 {
+		t.Fatalf("Expected dependencies to survive being stored")
+	}
+
+	tasklist.Delete(build)
+	if len(notes.BlockedBy) != 0 || len(design.Blocks) != 0 {
+		t.Fatalf("Expected dependencies on a deleted task to be removed")
+	}
+}
+
+func TestTimer(t *testing.T) {
+	task := NewTask("Write report", nil)
+	start := time.Unix(1000, 0)
+
+	if _, err := task.StopTimer(start); err == nil {
+		t.Fatalf("Expected an error stopping a timer which isn't running")
+	} else if _, ok := err.(TimerNotRunningError); !ok {
+		t.Fatalf("Expected a TimerNotRunningError, got %v", err)
+	}
+
+	if _, err := task.StartTimer(start); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := task.StartTimer(start); err == nil {
+		t.Fatalf("Expected an error starting a timer which is already running")
+	} else if _, ok := err.(TimerRunningError); !ok {
+		t.Fatalf("Expected a TimerRunningError, got %v", err)
+	}
+
+	if spent := task.TimeSpent(start.Add(time.Minute)); spent != 60 {
+		t.Fatalf("Expected a running timer to count up to now, got %v seconds", spent)
+	}
+
+	entry, err := task.StopTimer(start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Start != 1000 || entry.End != 4600 || task.TimerRunning() {
+		t.Fatalf("Expected a stopped entry from 1000 to 4600, got %+v", entry)
+	}
+
+	if spent := task.TimeSpent(start.Add(24 * time.Hour)); spent != 3600 {
+		t.Fatalf("Expected an hour spent, got %v seconds", spent)
+	}
+}
+
+func TestRollUp(t *testing.T) {
+	tasklist := NewTasklist()
+	now := time.Unix(10000, 0)
+
+	project, _ := tasklist.CreateTask("Project", nil)
+	subtasks := []*Task{}
+	for i := 0; i < 10; i++ {
+		subtask, _ := tasklist.CreateTask("Step", []string{project.ID})
+		subtasks = append(subtasks, subtask)
+	}
+	for _, subtask := range subtasks[:9] {
+		subtask.Complete = true
+	}
+
+	if progress := project.RollUp(now).Progress; progress != 90 {
+		t.Fatalf("Expected 9 of 10 subtasks done to be 90%%, got %v%%", progress)
+	}
+
+	// A subtask shared with another parent is only counted once.
+	other, _ := tasklist.CreateTask("Other", []string{project.ID})
+	shared, _ := tasklist.CreateTask("Shared", []string{subtasks[9].ID, other.ID})
+	shared.Estimate = 3600
+	shared.TimeEntries = []TimeEntry{{Start: 0, End: 1800}, {Start: 9000}}
+	subtasks[0].Estimate = 3600
+
+	rollUp := project.RollUp(now)
+	if rollUp.Estimate != 7200 || rollUp.TimeSpent != 2800 {
+		t.Fatalf("Expected 7200 seconds estimated and 2800 spent, got %+v", rollUp)
+	}
+	// The 8 other done steps have no estimate, so each counts for the
+	// average estimate, an hour, making 9 of 10 hours done.
+	if rollUp.Progress != 90 {
+		t.Fatalf("Expected 90%% of the work to be done, got %v%%", rollUp.Progress)
+	}
+
+	// Rolling up many tasks together gives the same answers as one at a
+	// time.
+	rollUps := NewRollUps(now)
+	for _, task := range tasklist.Registry {
+		if got, expected := rollUps.Get(task), task.RollUp(now); got != expected {
+			t.Fatalf("Expected %+v for %v, got %+v", expected, task.Name, got)
+		}
+	}
+
+	// Estimating one open step doesn't hide the unestimated ones done.
+	tasklist = NewTasklist()
+	project, _ = tasklist.CreateTask("Project", nil)
+	for i := 0; i < 9; i++ {
+		step, _ := tasklist.CreateTask("Done", []string{project.ID})
+		step.Complete = true
+	}
+	open, _ := tasklist.CreateTask("Open", []string{project.ID})
+	open.Estimate = 5 * 3600
+
+	if progress := project.RollUp(now).Progress; progress != 90 {
+		t.Fatalf("Expected 9 unestimated steps done and 1 estimated step open to be 90%%, got %v%%", progress)
+	}
+
+	project.MarkAsComplete()
+	if progress := project.RollUp(now).Progress; progress != 100 {
+		t.Fatalf("Expected a complete task to be 100%% done, got %v%%", progress)
+	}
+}
+
+func TestGuardBlockedCatchesCascades(t *testing.T) {
+	build := func() (Tasklist, *Task, *Task, *Task, *Task) {
+		tasklist := NewTasklist()
+		blocker, _ := tasklist.CreateTask("Sign off", nil)
+		parent, _ := tasklist.CreateTask("Release", nil)
+		done, _ := tasklist.CreateTask("Done step", []string{parent.ID})
+		last, _ := tasklist.CreateTask("Last step", []string{parent.ID})
+		done.MarkAsComplete()
+		parent.AddBlocker(blocker)
+
+		return tasklist, blocker, parent, done, last
+	}
+
+	changes := map[string]func(tasklist *Tasklist, last *Task){
+		"completing": func(tasklist *Tasklist, last *Task) { last.MarkAsComplete() },
+		"deleting":   func(tasklist *Tasklist, last *Task) { tasklist.Delete(last) },
+		"unlinking":  func(tasklist *Tasklist, last *Task) { tasklist.Move(last, last.Parents[0], nil) },
+	}
+
+	for name, change := range changes {
+		tasklist, blocker, parent, _, last := build()
+
+		err := tasklist.GuardBlocked(false, func() error {
+			change(&tasklist, last)
+			return nil
+		})
+
+		blockedErr, ok := err.(BlockedError)
+		if !ok || blockedErr.TaskID != parent.ID || strings.Join(blockedErr.BlockerIDs, ",") != blocker.ID {
+			t.Errorf("Expected %v the last subtask of a blocked parent to be refused, got %v", name, err)
+		}
+	}
+
+	tasklist, _, parent, _, last := build()
+	err := tasklist.GuardBlocked(true, func() error {
+		last.MarkAsComplete()
+		return nil
+	})
+	if err != nil || !parent.Complete {
+		t.Fatalf("Expected a forced change to complete the blocked parent, got %v", err)
+	}
+}
+
+func TestCyclesThroughSubtasksAndBlockers(t *testing.T) {
+	tasklist := NewTasklist()
+
+	parent, _ := tasklist.CreateTask("Parent", nil)
+	subtask, _ := tasklist.CreateTask("Subtask", []string{parent.ID})
+	grandchild, _ := tasklist.CreateTask("Grandchild", []string{subtask.ID})
+	other, _ := tasklist.CreateTask("Other", nil)
+
+	if _, ok := grandchild.AddBlocker(parent).(DependencyCycleError); !ok {
+		t.Fatal("Expected a DependencyCycleError for a task blocked by its own ancestor")
+	}
+
+	if err := grandchild.AddBlocker(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tasklist.Link(other, parent).(CycleError); !ok {
+		t.Fatal("Expected a CycleError for a subtask already waiting on its new parent")
+	}
+
+	// Cycles stored before they were refused are broken on load.
+	subtask.BlockedBy = append(subtask.BlockedBy, parent)
+	parent.Blocks = append(parent.Blocks, subtask)
+
+	restored := NewTasklistFromRecords(tasklist.Records())
+	if isWaitingOn(restored.Registry[parent.ID], restored.Registry[parent.ID]) {
+		t.Fatal("Expected the cycle through subtasks and blockers to be broken")
+	}
+}
@@ -7,7 +7,8 @@ import (
 )
 
 /*
-Tasklist provides an organized set of tasks.
+Tasklist provides an organized set of tasks. It serializes to (and from)
+json as an array of Records.
 */
 type Tasklist struct {
 	/*
@@ -23,7 +24,13 @@ type Tasklist struct {
 		RootTasks contains the root tasks in the list. These tasks have no
 		parents.
 	*/
-	RootTasks []*Task `json:"-"`
+	RootTasks []*Task
+
+	/*
+		touched holds the IDs of the tasks handed out, added, linked or
+		deleted since Track was called, or is nil when not tracking.
+	*/
+	touched map[string]bool
 }
 
 /*
@@ -36,6 +43,39 @@ func NewTasklist() Tasklist {
 	}
 }
 
+/*
+Track starts recording the tasks which are handed out by Get, added to the
+tasklist, linked, unlinked or deleted, until Touched is called. Whatever a
+change does to other tasks, like completing their parents, spreads from
+these ones through their parents and subtasks, so a change which only
+reaches tasks through the tasklist can be found by looking around the
+tasks recorded.
+*/
+func (ts *Tasklist) Track() {
+	ts.touched = make(map[string]bool)
+}
+
+/*
+Touched stops recording and returns the IDs of the tasks recorded since
+Track was called.
+*/
+func (ts *Tasklist) Touched() map[string]bool {
+	touched := ts.touched
+	ts.touched = nil
+
+	return touched
+}
+
+func (ts Tasklist) touch(tasks ...*Task) {
+	if ts.touched == nil {
+		return
+	}
+
+	for _, t := range tasks {
+		ts.touched[t.ID] = true
+	}
+}
+
 /*
 AddTask creates and adds a new task to the task list.
 */
@@ -47,41 +87,176 @@ func (ts *Tasklist) AddTask(name string, parents []*Task) *Task {
 	}
 
 	ts.Registry[task.ID] = task
+	ts.touch(task)
 
 	return task
 }
 
 /*
-Delete task from tasklist
+Get returns the task with the supplied ID, or a NotFoundError if the
+tasklist doesn't have one.
+*/
+func (ts Tasklist) Get(taskID string) (*Task, error) {
+	task, ok := ts.Registry[taskID]
+	if !ok {
+		return nil, NewNotFoundError(taskID)
+	}
+
+	ts.touch(task)
+
+	return task, nil
+}
+
+/*
+CreateTask creates and adds a new task to the task list, under the parents
+with the supplied IDs. An UnableToCreateTaskError is returned, and nothing
+is added, if the name is empty or any of the parents doesn't exist.
+*/
+func (ts *Tasklist) CreateTask(name string, parentIDs []string) (*Task, error) {
+	if name == "" {
+		return nil, UnableToCreateTaskError{
+			reason: "a task needs a name",
+			field:  "name",
+		}
+	}
+
+	var parents []*Task
+	for _, parentID := range parentIDs {
+		parent, err := ts.Get(parentID)
+		if err != nil {
+			return nil, UnableToCreateTaskError{
+				reason: err.Error(),
+				field:  "parentIDs",
+			}
+		}
+
+		parents = append(parents, parent)
+	}
+
+	return ts.AddTask(name, parents), nil
+}
+
+/*
+Delete task from tasklist. Just like Task.Delete() all of the task's
+subtasks are deleted along with it, so they are removed from the tasklist
+as well.
 */
 func (ts *Tasklist) Delete(task *Task) {
-	delete(ts.Registry, task.ID)
+	deleted := make(map[string]*Task)
+	collectSubtree(task, deleted)
 
-	if task.IsRootTask() {
-		ts.RootTasks = deleteFromSliceByID(ts.RootTasks, task.ID)
+	for id, t := range deleted {
+		delete(ts.Registry, id)
+		ts.touch(t)
+		ts.touch(t.Blocks...)
+
+		if findTaskInSlice(ts.RootTasks, id) != -1 {
+			ts.RootTasks = deleteFromSliceByID(ts.RootTasks, id)
+		}
+
+		// Tasks left behind stop waiting on deleted tasks, and stop
+		// blocking them.
+		for _, waiting := range append([]*Task(nil), t.Blocks...) {
+			waiting.RemoveBlocker(t)
+		}
+		for _, blocker := range append([]*Task(nil), t.BlockedBy...) {
+			t.RemoveBlocker(blocker)
+		}
 	}
 
 	task.Delete()
 }
 
 /*
-Store serializes the contents of the tasklist to the specified file.
+Link makes subtask a subtask of parent, just like Task.AddSubtask(), and
+takes the subtask out of the root tasks if it was one.
+*/
+func (ts *Tasklist) Link(parent *Task, subtask *Task) error {
+	ts.touch(parent, subtask)
+
+	if err := parent.AddSubtask(subtask); err != nil {
+		return err
+	}
+
+	if findTaskInSlice(ts.RootTasks, subtask.ID) != -1 {
+		ts.RootTasks = deleteFromSliceByID(ts.RootTasks, subtask.ID)
+	}
+
+	return nil
+}
+
+/*
+Unlink removes subtask from parent's subtasks, just like
+Task.RemoveSubtask(), and adds the subtask to the root tasks if it has no
+parents left.
+*/
+func (ts *Tasklist) Unlink(parent *Task, subtask *Task) {
+	ts.touch(parent, subtask)
+
+	parent.RemoveSubtask(subtask)
+
+	if subtask.IsRootTask() && findTaskInSlice(ts.RootTasks, subtask.ID) == -1 {
+		ts.RootTasks = append(ts.RootTasks, subtask)
+	}
+}
+
+/*
+Move moves a task from one parent to another in a single step. Either
+parent can be nil, moving the task out of or into the root tasks. Moving a
+task to a parent it already has just removes it from the other one. If the
+task can't be linked to its new parent, a CycleError is returned and
+nothing is moved.
+*/
+func (ts *Tasklist) Move(task *Task, from *Task, to *Task) error {
+	if to != nil {
+		if err := ts.Link(to, task); err != nil {
+			return err
+		}
+	}
+
+	if from != nil && from != to {
+		ts.Unlink(from, task)
+	}
+
+	return nil
+}
+
+/*
+collectSubtree adds the task and everything below it to the collected map.
+Tasks reachable through more than one path are only visited once.
+*/
+func collectSubtree(task *Task, collected map[string]*Task) {
+	if _, ok := collected[task.ID]; ok {
+		return
+	}
+
+	collected[task.ID] = task
+
+	for _, subtask := range task.Subtasks {
+		collectSubtree(subtask, collected)
+	}
+}
+
+/*
+Store serializes the contents of the tasklist to the specified file, as a
+snapshot in the same format the storage package's json file backend
+writes.
 */
 func (ts Tasklist) Store(filename string) error {
 	file, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
 	encoder := json.NewEncoder(file)
-	err = encoder.Encode(ts)
-
-	return err
+	return encoder.Encode(ts)
 }
 
 /*
 Restore restores a serialized tasklist to the tasklist object from
-the file specified.
+the file specified. Files written in older versions of the snapshot format
+are upgraded as they're read, the file itself is left as it is.
 */
 func (ts *Tasklist) Restore(filename string) error {
 	contents, err := ioutil.ReadFile(filename)
@@ -89,18 +264,5 @@ func (ts *Tasklist) Restore(filename string) error {
 		return err
 	}
 
-	err = json.Unmarshal(contents, &ts)
-	if err != nil {
-		return err
-	}
-
-	ts.RootTasks = []*Task{}
-
-	for _, task := range ts.Registry {
-		if task.IsRootTask() {
-			ts.RootTasks = append(ts.RootTasks, task)
-		}
-	}
-
-	return nil
+	return json.Unmarshal(contents, ts)
 }
@@ -0,0 +1,93 @@
+package task
+
+import (
+	"time"
+)
+
+/*
+TimeEntry is a stretch of time spent working on a task, from Start to End
+(both unix timestamps). End is 0 while the timer is still running.
+*/
+type TimeEntry struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+/*
+Running returns true if the entry's timer hasn't been stopped yet.
+*/
+func (e TimeEntry) Running() bool {
+	return e.End == 0
+}
+
+/*
+Duration is how many seconds the entry covers. A running entry covers the
+time up to now.
+*/
+func (e TimeEntry) Duration(now time.Time) int64 {
+	end := e.End
+	if e.Running() {
+		end = now.Unix()
+	}
+
+	if end < e.Start {
+		return 0
+	}
+
+	return end - e.Start
+}
+
+/*
+TimerRunning returns true if time is being logged against the task right
+now.
+*/
+func (t Task) TimerRunning() bool {
+	return len(t.TimeEntries) > 0 && t.TimeEntries[len(t.TimeEntries)-1].Running()
+}
+
+/*
+StartTimer starts logging time against the task from now, with a new
+running time entry. If the timer is already running a TimerRunningError is
+returned and nothing is changed.
+*/
+func (t *Task) StartTimer(now time.Time) (TimeEntry, error) {
+	if t.TimerRunning() {
+		return TimeEntry{}, NewTimerRunningError(t.ID)
+	}
+
+	entry := TimeEntry{Start: now.Unix()}
+	t.TimeEntries = append(t.TimeEntries, entry)
+
+	return entry, nil
+}
+
+/*
+StopTimer ends the running time entry of the task now, and returns it. If
+the timer isn't running a TimerNotRunningError is returned.
+*/
+func (t *Task) StopTimer(now time.Time) (TimeEntry, error) {
+	if !t.TimerRunning() {
+		return TimeEntry{}, NewTimerNotRunningError(t.ID)
+	}
+
+	entry := &t.TimeEntries[len(t.TimeEntries)-1]
+	entry.End = now.Unix()
+	if entry.End < entry.Start {
+		entry.End = entry.Start
+	}
+
+	return *entry, nil
+}
+
+/*
+TimeSpent is how many seconds have been logged against the task itself,
+counting a running timer up to now.
+*/
+func (t Task) TimeSpent(now time.Time) int64 {
+	var spent int64
+	for _, entry := range t.TimeEntries {
+		spent += entry.Duration(now)
+	}
+
+	return spent
+}
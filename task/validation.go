@@ -0,0 +1,227 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+Limits on the fields of a task, enforced by the validation rules.
+*/
+const (
+	MaxNameLength     = 200
+	MaxNotesLength    = 10000
+	MaxCategoryLength = 50
+	MaxCategories     = 20
+	MaxPriority       = PriorityHigh
+
+	/*
+		MaxDueDate is the last second of the year 9999. Due dates are unix
+		timestamps, anything later is much more likely to be a mistake (a
+		timestamp in milliseconds, say) than a real due date.
+	*/
+	MaxDueDate = 253402300799
+
+	/*
+		MaxEstimate is ten years in seconds, far more than any one task
+		should be estimated at.
+	*/
+	MaxEstimate = 10 * 365 * 24 * 60 * 60
+)
+
+/*
+Violation describes a single validation rule broken by a field of a task.
+*/
+type Violation struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+/*
+ValidationError is used to signify that the fields of a task broke one or
+more of the validation rules. It lists every rule broken, not just the
+first one.
+*/
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (t ValidationError) Error() string {
+	return fmt.Sprintf("Invalid task (%v)", t.Messages())
+}
+
+/*
+Messages joins the messages of every violation into one.
+*/
+func (t ValidationError) Messages() string {
+	messages := make([]string, 0, len(t.Violations))
+	for _, violation := range t.Violations {
+		messages = append(messages, violation.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+/*
+Fields holds the fields of a task which are filled in by whoever creates or
+updates it, and so are checked by the validation rules.
+*/
+type Fields struct {
+	Name       string
+	Notes      string
+	Priority   int
+	DueDate    int64
+	Estimate   int64
+	Categories []string
+	Recurrence string
+}
+
+/*
+rule checks a single field of a task, returning a description of what's
+wrong with it, or an empty string if nothing is.
+*/
+type rule struct {
+	field string
+	check func(fields Fields) string
+}
+
+/*
+rules holds every validation rule, checked in order.
+*/
+var rules = []rule{
+	{"name", func(fields Fields) string {
+		if strings.TrimSpace(fields.Name) == "" {
+			return "name is required"
+		}
+		return ""
+	}},
+	{"name", func(fields Fields) string {
+		if utf8.RuneCountInString(fields.Name) > MaxNameLength {
+			return fmt.Sprintf("name can't be longer than %v characters", MaxNameLength)
+		}
+		return ""
+	}},
+	{"notes", func(fields Fields) string {
+		if utf8.RuneCountInString(fields.Notes) > MaxNotesLength {
+			return fmt.Sprintf("notes can't be longer than %v characters", MaxNotesLength)
+		}
+		return ""
+	}},
+	{"priority", func(fields Fields) string {
+		if fields.Priority < PriorityNone || fields.Priority > MaxPriority {
+			return fmt.Sprintf("priority must be from %v (none) to %v (high)", PriorityNone, MaxPriority)
+		}
+		return ""
+	}},
+	{"dueDate", func(fields Fields) string {
+		if fields.DueDate < 0 {
+			return "dueDate can't be negative, leave it out (or 0) for no due date"
+		}
+		return ""
+	}},
+	{"dueDate", func(fields Fields) string {
+		if fields.DueDate > MaxDueDate {
+			return "dueDate must be a unix timestamp in seconds, before the year 10000"
+		}
+		return ""
+	}},
+	{"estimate", func(fields Fields) string {
+		if fields.Estimate < 0 || fields.Estimate > MaxEstimate {
+			return fmt.Sprintf("estimate must be a number of seconds from 0 (no estimate) to %v", MaxEstimate)
+		}
+		return ""
+	}},
+	{"recurrence", func(fields Fields) string {
+		if fields.Recurrence == "" {
+			return ""
+		}
+		if _, err := ParseRecurrence(fields.Recurrence); err != nil {
+			return fmt.Sprintf("recurrence isn't a supported rule (%v)", err)
+		}
+		return ""
+	}},
+	{"categories", func(fields Fields) string {
+		if len(fields.Categories) > MaxCategories {
+			return fmt.Sprintf("a task can't have more than %v categories", MaxCategories)
+		}
+		return ""
+	}},
+	{"categories", func(fields Fields) string {
+		for _, category := range fields.Categories {
+			if utf8.RuneCountInString(category) > MaxCategoryLength {
+				return fmt.Sprintf("categories can't be longer than %v characters", MaxCategoryLength)
+			}
+		}
+		return ""
+	}},
+}
+
+/*
+Normalize tidies up the fields without changing their meaning. Surrounding
+whitespace is trimmed from the name, categories are normalized by
+NormalizeCategories(), and a valid recurrence rule is rewritten in its
+canonical form.
+*/
+func (f *Fields) Normalize() {
+	f.Name = strings.TrimSpace(f.Name)
+	f.Categories = NormalizeCategories(f.Categories)
+
+	if recurrence, err := ParseRecurrence(f.Recurrence); err == nil {
+		f.Recurrence = recurrence.String()
+	}
+}
+
+/*
+Violations checks the fields against every validation rule and returns the
+rules they break. Fields should be normalized first.
+*/
+func (f Fields) Violations() []Violation {
+	violations := []Violation{}
+	for _, rule := range rules {
+		if message := rule.check(f); message != "" {
+			violations = append(violations, Violation{
+				Field:   rule.field,
+				Message: message,
+			})
+		}
+	}
+
+	return violations
+}
+
+/*
+Validate returns a ValidationError listing every rule the fields break, or
+nil if they don't break any.
+*/
+func (f Fields) Validate() error {
+	violations := f.Violations()
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return ValidationError{
+		Violations: violations,
+	}
+}
+
+/*
+NormalizeCategories trims whitespace from categories and lower cases them,
+then drops empty and repeated ones, keeping the first of each.
+*/
+func NormalizeCategories(categories []string) []string {
+	normalized := make([]string, 0, len(categories))
+	seen := make(map[string]bool)
+
+	for _, category := range categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if category == "" || seen[category] {
+			continue
+		}
+
+		seen[category] = true
+		normalized = append(normalized, category)
+	}
+
+	return normalized
+}